@@ -0,0 +1,46 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// flushResponse is the optional acceptance report of the remote address, rejected_indexes are the
+// indexes in the flushed payload of the rejected entries
+type flushResponse struct {
+	Accepted        int   `json:"accepted"`
+	Rejected        int   `json:"rejected"`
+	RejectedIndexes []int `json:"rejected_indexes"`
+}
+
+// checkAcceptance reads the acceptance report of a successful flush of the batch and returns the rejected
+// entries listed by rejected_indexes, responses without a JSON report, e.g. an empty body, mean every entry
+// was accepted. the rejected entries are kept pending to be resent with the next flush when RequeueRejected is set
+func (a *Activity) checkAcceptance(batch []Entry, body []byte) []Entry {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var response flushResponse
+	if json.Unmarshal(body, &response) != nil || response.Rejected <= 0 {
+		return nil
+	}
+	a.stats.rejected.Add(uint64(response.Rejected))
+	a.log().Warn("REJECTED", "accepted", response.Accepted, "rejected", response.Rejected)
+	if len(response.RejectedIndexes) == 0 {
+		return nil
+	}
+
+	// the payload is the batch as sent, aggregate keeps the order so the indexes match
+	payload := a.payloadEntries(batch)
+	var rejected []Entry
+	for _, i := range response.RejectedIndexes {
+		if i >= 0 && i < len(payload) {
+			rejected = append(rejected, payload[i])
+		}
+	}
+	if a.requeueRejected {
+		// the mirrors already got the rejected entries along with the batch
+		a.keepPending([]pendingBatch{{entries: rejected, mirrored: true}})
+	}
+	return rejected
+}
@@ -0,0 +1,76 @@
+package crossover_activity
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRejectedEntriesRequeued(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]Entry
+	remote := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var batch []Entry
+		_ = json.Unmarshal(body, &batch)
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, batch)
+		if len(batches) == 1 {
+			_, _ = rw.Write([]byte(`{"accepted":2,"rejected":1,"rejected_indexes":[1]}`))
+		}
+	}))
+	defer remote.Close()
+	a := newTestActivity(t, &Config{
+		RemoteAddress:     remote.URL,
+		FlushInterval:     60,
+		MaxPendingBatches: 10,
+		RequeueRejected:   true,
+	}, nil)
+
+	serve(a, "GET", "/first", "")
+	serve(a, "GET", "/rejected", "")
+	serve(a, "GET", "/third", "")
+	a.Flush()
+	if rejected := a.Stats().Rejected; rejected != 1 {
+		t.Fatalf("rejected = %d, want 1", rejected)
+	}
+	a.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 {
+		t.Fatalf("batches = %v, want the flushed batch and the requeued entry", batches)
+	}
+	if len(batches[1]) != 1 || batches[1][0].RequestId != "rejected" || batches[1][0].Count != 1 {
+		t.Fatalf("requeued = %v, want the rejected entry only", batches[1])
+	}
+}
+
+func TestEmptyResponseAcceptsEverything(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress:     remote.URL,
+		FlushInterval:     60,
+		MaxPendingBatches: 10,
+		RequeueRejected:   true,
+	}, nil)
+
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	a.Flush()
+	if calls, rejected := len(remote.calls()), a.Stats().Rejected; calls != 1 || rejected != 0 {
+		t.Fatalf("calls, rejected = %d, %d, want 1, 0", calls, rejected)
+	}
+}
+
+func TestRequeueRejectedRequiresMaxPendingBatches(t *testing.T) {
+	err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", RequeueRejected: true})
+	if err == nil || !strings.Contains(err.Error(), "MaxPendingBatches") {
+		t.Fatalf("err = %v, want the MaxPendingBatches error", err)
+	}
+}
@@ -2,33 +2,295 @@ package crossover_activity
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	DefaultTimeout                  = 10
 	MaxRequestBodySize        int64 = 2 * 1024 * 1024 // 2 MB
+	MaxResponseBodySize       int64 = 64 * 1024       // 64 KB read from the remote address responses
 	DefaultLogBufferSize            = 100000          // buffer size for the log entries channel
 	DefaultMaxBatchSize             = 20              // number of activity to batch together
 	DefaultBatchFlushInterval       = 2               // Time interval to flush logs to the database
+	DefaultParseFailureCount        = 0               // count used when the json body can't be parsed
+	DefaultScalarCount              = 1               // count used when the json body is a scalar
+	DefaultAuthHeader               = "X-Api-Key"     // header carrying the APIKey
+	ParseFailureLogInterval         = time.Minute     // minimum interval between two parse failure logs
+)
+
+// IdGroupName name of the pattern group holding the request id, patterns without it use their first group
+const IdGroupName = "id"
+
+// errors of the invalid configs returned by New, wrapped with the details of the config
+var (
+	ErrEmptyAPIKey        = errors.New("APIKey can't be empty")
+	ErrEmptyPattern       = errors.New("pattern can't be empty")
+	ErrEmptyRemoteAddress = errors.New("RemoteAddress can't be empty")
+	ErrInvalidRemoteURL   = errors.New("invalid RemoteAddress")
+)
+
+// Version of the plugin sent in the default UserAgent, set on release
+const Version = "dev"
+
+// IdempotencyKeyHeader header carrying the key of the flushed batch, the same for every retry and resend of the batch
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// CompressionGzip compresses the flushed batches with gzip
+const CompressionGzip = "gzip"
+
+// overflow policies deciding which entry is dropped when the channel is full
+const (
+	OverflowDropNew = "drop-new"
+	OverflowDropOld = "drop-old"
+)
+
+// count modes of the JSON-RPC calls of a request
+const (
+	CountModeAll    = "all"          // every call, notifications included
+	CountModeRPCIds = "rpc-ids-only" // calls with a non null id, notifications aren't counted
+)
+
+// body capture modes
+const (
+	CaptureBodyNone = "none"
+	CaptureBodyHash = "hash"
+	CaptureBodyFull = "full"
 )
 
 // Config holds configuration to passed to the plugin
 type Config struct {
+	// Pattern the request id is the group named id, or the first group, of the match, or the whole match if it has no groups
 	Pattern       string
 	RemoteAddress string
+	// APIKey key sent in the AuthHeader, ${NAME} reads it from the environment variable NAME on start
 	APIKey        string
 	BufferSize    int
 	BatchSize     int
 	FlushInterval int
+	// MaxPendingBatches number of failed batches kept in memory and resent with the next flush, 0 drops failed batches
+	MaxPendingBatches int
+	// ParseFailureCount count recorded for a json body that can't be parsed, defaults to 0
+	ParseFailureCount *int
+	// ScalarCount count recorded for a json body that's a scalar (e.g. 42, "foo", true or null), defaults to 1
+	ScalarCount *int
+	// CaptureBody sends the request body along with the count: "none" (default), "hash" (sha256 hex) or "full".
+	// "full" stores the raw body, up to MaxBodySize, with every entry which is storage heavy and
+	// may leak sensitive client data to the collector, use it only when it's required for auditing
+	CaptureBody string
+	// DisableCounting records a count of 1 for every request without parsing the body,
+	// the body isn't even buffered unless it's captured or its JSON-RPC methods are needed
+	DisableCounting bool
+	// DisableKeying records every request under an empty request id without matching the path
+	DisableKeying bool
+	// TimeBucket tags every entry with the minute it was recorded in, entries of different minutes are never merged
+	TimeBucket bool
+	// SyncPattern paths matching this pattern are recorded synchronously before being served
+	SyncPattern string
+	// FailClosed rejects requests matching SyncPattern with 503 when their activity can't be recorded
+	FailClosed bool
+	// SketchMode aggregates counts in a count-min sketch flushed every FlushInterval, trading exact counts for bounded memory.
+	// counts are overestimated by at most e/SketchWidth of the total count with probability 1-e^-SketchDepth,
+	// keys beyond SketchMaxKeys in an interval are reported together under SketchOverflowKey
+	SketchMode    bool
+	SketchWidth   int
+	SketchDepth   int
+	SketchMaxKeys int
+	// PatternList additional patterns tried in order when Pattern doesn't match
+	PatternList []string
+	// Patterns named patterns tried in name order when Pattern and PatternList don't match, the matching name is sent with the entry
+	Patterns map[string]string
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout in seconds bound each phase of a flush call
+	DialTimeout           int
+	TLSHandshakeTimeout   int
+	ResponseHeaderTimeout int
+	// ValidateSchemaOnStart posts a sample batch on start and logs a warning if the remote address doesn't accept it
+	ValidateSchemaOnStart bool
+	// SchemaMarker text the remote address response must contain for the sample batch to be considered understood
+	SchemaMarker string
+	// PriorityMethods JSON-RPC methods (e.g. trace_*) recorded in a priority channel that's drained first
+	// and falls back to the normal channel when full, so they're dropped only after the normal channel is full
+	PriorityMethods []string
+	// PriorityBufferSize buffer size for the priority entries channel, defaults to BufferSize
+	PriorityBufferSize int
+	// PipelinedEncoding encodes batches in a dedicated goroutine feeding another goroutine sending them,
+	// so CPU bound encoding doesn't stall the batch assembly
+	PipelinedEncoding bool
+	// CountFloors minimum count recorded per request id, request ids without a floor record their actual count
+	CountFloors map[string]int
+	// CountOnlyProxied records requests after they're served and only if the next handler wrote a response,
+	// requests short-circuited without reaching the backend aren't counted. paths matching SyncPattern
+	// are still recorded before being served
+	CountOnlyProxied bool
+	// MaxRetries number of times a failed flush is retried before the batch is dropped or kept pending
+	MaxRetries int
+	// JitterStrategy randomization of the exponential backoff between retries: "none", "full" (default), "equal" or "decorrelated"
+	JitterStrategy string
+	// MaxRetryWindow seconds bounding a flush and all its retries so an outage doesn't stall the batchProcessor, defaults to 30
+	MaxRetryWindow int
+	// SplitReadWrite records the read and write JSON-RPC calls of the request separately along with the total count,
+	// they add up to the count: calls the count leaves out, e.g. notifications in the rpc-ids-only CountMode, are left
+	// out of both and the calls a CountFloors adds are reads
+	SplitReadWrite bool
+	// MethodClasses overrides the built-in classification of JSON-RPC methods as "read" or "write"
+	MethodClasses map[string]string
+	// MethodMaxCount caps the count a single JSON-RPC method contributes to one request
+	MethodMaxCount map[string]int
+	// RecordUpgrades records WebSocket upgrades and SSE streams once when the connection is established,
+	// with the connection type, without reading their body
+	RecordUpgrades bool
+	// MaxWorkerGoroutines bounds the goroutines running flushes, with their retries, mirror sends and other asynchronous
+	// work together, once reached the work is queued instead of spawning more goroutines and a flush sends to the mirrors
+	// itself. FlushConcurrency flushes draw from it too. 0 flushes in the batchProcessor goroutine. the batchProcessor,
+	// the PipelinedEncoding stages and the OverflowPath replay are long lived goroutines outside of the bound
+	MaxWorkerGoroutines int
+	// SigningSecret signs every flush with HMAC-SHA256 over a timestamp, a nonce and the payload
+	SigningSecret string
+	// AuditLogPath file where a JSON line summarizing every batch accepted by the remote address is appended, the
+	// sequence of the records carries on from the last record of the file across restarts
+	AuditLogPath string
+	// MaxBodySize bytes of the request body read for counting, defaults to MaxRequestBodySize. counting sees bodies
+	// beyond the limit truncated so a JSON batch larger than the limit can't be parsed and is counted as a parse failure,
+	// the next handler still receives the full body. truncated bodies, gzipped ones once decompressed, are counted in Stats.Truncated
+	MaxBodySize int64
+	// Compression of the flushed batches, "gzip" or empty (default) to send them uncompressed
+	Compression string
+	// AuthHeader header carrying the APIKey, defaults to X-Api-Key
+	AuthHeader string
+	// AuthScheme prefixes the APIKey in the AuthHeader, e.g. Bearer with Authorization as AuthHeader
+	AuthScheme string
+	// Timeout seconds bounding a single flush call, defaults to DefaultTimeout
+	Timeout int
+	// SampleRate fraction, from 0 to 1 (default), of the requests recorded, requests recorded synchronously by SyncPattern aren't sampled
+	SampleRate *float64
+	// ScaleSampledCounts scales the counts of the sampled entries by 1/SampleRate to keep the totals unbiased
+	ScaleSampledCounts bool
+	// FlushMethod HTTP method of the flush calls, defaults to POST
+	FlushMethod string
+	// ExtraHeaders static headers set on every flush call
+	ExtraHeaders map[string]string
+	// UserAgent User-Agent of the flush calls, defaults to crossover-activity/<Version> (<middleware name>)
+	// so the calls of each middleware are told apart in the remote address logs
+	UserAgent string
+	// MaxBatchBytes flushes the batch early once its estimated encoded size reaches this many bytes, 0 disables the limit
+	MaxBatchBytes int
+	// FlushJitter fraction, from 0 (default) to 1, of FlushInterval each flush interval is randomized by
+	// so instances started together don't flush in lockstep, e.g. 0.2 waits between 80% and 120% of FlushInterval
+	FlushJitter float64
+	// TLSCertFile and TLSKeyFile PEM client certificate and key presented to the remote address for mutual TLS
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSCAFile PEM bundle of the CAs trusted to verify the remote address instead of the system ones
+	TLSCAFile string
+	// CountOnlyStatus records requests after they're served and only if the response status is one of these, e.g. [200],
+	// a handler writing no response at all responds 200. empty records every status. paths matching SyncPattern
+	// are still recorded before being served
+	CountOnlyStatus []int
+	// OverflowPath file the entries that don't fit in the full channel are appended to, they're re-enqueued once
+	// the channel drains. entries left on close are kept in the file and re-enqueued by the next start
+	OverflowPath string
+	// OverflowMaxBytes size of the entries kept in OverflowPath, defaults to DefaultOverflowMaxBytes, entries beyond it are dropped
+	OverflowMaxBytes int64
+	// EnqueueRate caps the entries of a request id enqueued per second, the counts beyond it are held and
+	// enqueued with the next allowed entry or flush so they aren't lost. 0 (default) disables the limit
+	EnqueueRate float64
+	// EnqueueBurst entries of a request id enqueued at once before EnqueueRate applies, defaults to EnqueueRate rounded up
+	EnqueueBurst int
+	// TenantHeader request header the tenant of the request is read from, entries of different tenants are never merged
+	TenantHeader string
+	// DefaultTenant tenant of the requests without the TenantHeader
+	DefaultTenant string
+	// OverflowPolicy entry dropped when the channel is full and the entry doesn't fit in OverflowPath either:
+	// "drop-new" (default) drops the incoming entry, "drop-old" drops the oldest buffered entry to favor fresh data
+	OverflowPolicy string
+	// RequeueRejected keeps the entries the remote address reports as rejected, by their rejected_indexes
+	// in a {"accepted": N, "rejected": M, "rejected_indexes": [...]} response, pending to be resent with the next flush, it requires MaxPendingBatches
+	RequeueRejected bool
+	// IncludeClientIP sends the client IP, the leftmost X-Forwarded-For address or the remote address, with every entry,
+	// entries of different client IPs are never merged
+	IncludeClientIP bool
+	// FlushConcurrency flushes running at once in a dedicated pool, within MaxWorkerGoroutines when set, defaults
+	// to 1 which keeps flushing in the batchProcessor goroutine, or the MaxWorkerGoroutines pool when set. beyond 1
+	// batches may reach the remote address out of order and a pending batch is resent by whichever flush takes it first
+	FlushConcurrency int
+	// Format of the flushed batches, "json-array" (default) or "ndjson" with an entry per line. SetEncoder
+	// replaces it with a custom Encoder
+	Format string
+	// BodyReadTimeout seconds bounding the read of the counted part of the request body so a stalled body doesn't hold
+	// the handler, requests exceeding it are rejected with 408. 0 (default) sets no deadline. the rest of the body read
+	// by the next handler isn't bounded by it, the bound only applies when the server connection supports read deadlines
+	BodyReadTimeout int
+	// DryRun logs the batches that would be flushed, with the flush call target and headers, instead of sending them
+	DryRun bool
+	// CountMode JSON-RPC calls counted: "all" (default) or "rpc-ids-only" to skip notifications, calls without a non null id
+	CountMode string
+	// AnchorPattern matches Pattern, PatternList and Patterns against the whole path instead of anywhere in it,
+	// e.g. /rpc then matches /rpc but no longer /not-rpc-really. SyncPattern isn't anchored
+	AnchorPattern bool
+	// RemoteAddresses additional addresses every batch is mirrored to, the first one is the primary when RemoteAddress isn't set.
+	// batches are kept pending and retried for the primary only, a failing mirror is counted and logged
+	RemoteAddresses []string
+	// CountBody false is the same as DisableCounting, the body isn't read unless something else needs it. defaults to true
+	CountBody *bool
+	// TraceFlushes sets a W3C traceparent on every flush call, a new trace per flush or a child span of the request's trace
+	// for the synchronous flushes of SyncPattern, so flushes can be correlated in distributed traces
+	TraceFlushes bool
+	// MaxEntryAge milliseconds an entry waits before its batch is flushed, regardless of BatchSize and FlushInterval,
+	// bounding how stale the activity gets when the channel is backed up. 0 (default) disables it, it doesn't apply to SketchMode
+	MaxEntryAge int
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout, in seconds, tune the reuse of the flush connections,
+	// zero keeps the defaults of http.DefaultTransport
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     int
+	// BreakerThreshold consecutive failed flushes to a remote address opening its circuit, no flush is attempted while
+	// it's open and the batches fail right away: they're kept pending up to MaxPendingBatches, dropped beyond it or
+	// without it. 0 (default) disables the circuit breaker
+	BreakerThreshold int
+	// BreakerCooldown seconds the circuit stays open before a flush probes the remote address, defaults to DefaultBreakerCooldown
+	BreakerCooldown int
+	// PatternBatches BatchSize and FlushInterval by name of Patterns, the entries of these patterns are batched apart from
+	// the other entries. MaxBatchBytes and MaxEntryAge only apply to the other entries, SketchMode ignores the overrides
+	PatternBatches map[string]PatternBatch
+	// SlowMatchThreshold microseconds matching the patterns against a path may take before the match is logged and
+	// counted in Stats.SlowMatches, surfacing patterns too costly for the hot path. 0 (default) doesn't time the matches
+	SlowMatchThreshold int
+	// RejectWhenFull responds 503 with a Retry-After of FlushInterval instead of serving the request when the buffer
+	// channel is full and the entry can't go to the overflow file, rather than dropping its activity. it takes precedence
+	// over the drop-old OverflowPolicy. requests recorded once served, see CountOnlyProxied and CountOnlyStatus, can't be rejected
+	RejectWhenFull bool
+	// EventMode sends every recorded request as an event with its time and path instead of summing the entries of a batch
+	// into counts, the events are still batched. it can't be combined with SketchMode
+	EventMode bool
+	// DedupHeader request header, e.g. Idempotency-Key, whose value identifies the retries of a request, a request with the
+	// value of an earlier recorded request of the same request id within DedupTTL seconds is served but not recorded again.
+	// DedupTTL defaults to DefaultDedupTTL and DedupMaxKeys, bounding the values remembered, to DefaultDedupMaxKeys
+	DedupHeader  string
+	DedupTTL     int
+	DedupMaxKeys int
+	// SlowFlushThreshold milliseconds a flush call to a remote address may take before it's logged, 0 (default) logs none.
+	// the duration of every call is in the flush_latency_seconds histogram of the MetricsHandler either way
+	SlowFlushThreshold int
+	// CountJSONPath path of the array counted in JSON bodies, e.g. $.requests for {"requests": [...]} or $.batches[0].calls,
+	// instead of the top level array. bodies without an array at the path are counted like the bodies without CountJSONPath
+	CountJSONPath string
 }
 
 // CreateConfig populates the config data object
@@ -37,21 +299,135 @@ func CreateConfig() *Config {
 }
 
 type Activity struct {
-	logsChannel     chan activityRequestDto
+	logsChannel     chan Entry
+	priorityChannel chan Entry // nil unless PriorityMethods is set
+	priorityMethods []string
+	encodeChannel   chan []Entry // nil unless PipelinedEncoding is set
+	sendChannel     chan encodedBatch
+	countFloors     map[string]int
+	counterSink     counterSink
+	countProxied    bool
+	countStatus     map[int]bool
+	maxRetries      int
+	jitterStrategy  string
+	splitReadWrite  bool
+	readBody        bool // whether counting, body capture or method parsing needs the request body
+	methodClasses   map[string]string
+	methodMaxCount  map[string]int
+	recordUpgrades  bool
+	workers         *workerPool  // nil unless MaxWorkerGoroutines is set
+	flushWorkers    *workerPool  // nil unless FlushConcurrency is above 1
+	formatEncoder   Encoder      // encoder of Format
+	batchEncoder    atomic.Value // encoderValue, swapped at runtime by SetEncoder
+	dryRun          bool
+	countMode       string
+	anchorPattern   bool
+	traceFlushes    bool
+	batch           []Entry // owned by the batchProcessor goroutine
+	batchBytes      int     // estimated encoded size of the batch, owned by the batchProcessor goroutine
+	batchOldest     int64   // enqueue time of the oldest entry of the batch, owned by the batchProcessor goroutine
+	maxEntryAge     time.Duration
+	ageTimer        *time.Timer // fires once the oldest entry of the batch reaches maxEntryAge
+	maxBatchBytes   int
+	flushJitter     float64
+	config          Config // config after defaults, used to dump the state
 	next            http.Handler
 	name            string
 	client          *http.Client
-	compiledPattern *regexp.Regexp
+	compiledPattern atomic.Value   // *regexp.Regexp, swapped at runtime by SetPattern
+	namedPatterns   []namedPattern // PatternList, unnamed, followed by Patterns
+	schemaMarker    string
 	remoteAddress   string
+	primary         *endpoint      // RemoteAddress, or the first RemoteAddresses, which failed batches are kept pending for
+	mirrors         []*endpoint    // the other RemoteAddresses
+	mirrorsWG       sync.WaitGroup // mirror sends in flight, waited for on close
 	apiKey          string
 	batchSize       int
 	flushInterval   int
+	pending         pendingBatches
+	parseFailCount  int
+	scalarCount     int
+	captureBody     string
+	disableCounting bool
+	disableKeying   bool
+	timeBucket      bool
+	syncPattern     *regexp.Regexp
+	failClosed      bool
+	sketch          *countMinSketch // owned by the batchProcessor goroutine
+	lastParseLog    atomic.Int64    // unix nano of the last parse failure log
+	stats           stats
+	signingSecret   []byte
+	audit           *auditLog      // nil unless AuditLogPath is set
+	overflow        *overflowQueue // nil unless OverflowPath is set
+	overflowDone    chan struct{}  // closed once replayOverflow returns
+	done            chan struct{}  // closed by Close to stop the batchProcessor
+	stopped         chan struct{}  // closed by the batchProcessor once the remaining entries are flushed
+	senderDone      chan struct{}  // closed by the sender once the encoded batches are sent
+	closeOnce       sync.Once
+	releaseOnce     sync.Once
+	closed          atomic.Bool
+	closeErr        error
+	retryWindow     time.Duration
+	maxBodySize     int64
+	bodyReadTimeout time.Duration
+	compression     string
+	authHeader      string
+	authValue       string
+	ctx             context.Context // derived from the New context, cancelled once the plugin is closed
+	cancel          context.CancelFunc
+	sampler         *sampler     // nil unless SampleRate is set
+	limiter         *rateLimiter // nil unless EnqueueRate is set
+	tenantHeader    string
+	defaultTenant   string
+	dropOld         bool
+	requeueRejected bool
+	includeClientIP bool
+	flushMethod     string
+	extraHeaders    map[string]string
+	flushRequests   chan chan struct{}     // Flush requests, closed by the batchProcessor once flushed
+	logger          atomic.Value           // loggerValue, swapped at runtime by SetLogger
+	onFlush         atomic.Value           // flushHook, set by SetOnFlush
+	transformID     atomic.Value           // idTransform, set by SetTransformID
+	bodyCounters    bodyCounters           // registered by RegisterCounter
+	routeBatches    map[string]*routeBatch // PatternBatches by pattern name
+	routeExpired    chan *routeBatch       // route batches whose flush interval expired
+	logsMu          sync.RWMutex           // held by the senders to logsChannel, locked by Resize to swap it
+	resizeRequests  chan resizeRequest     // Resize requests, handled by the batchProcessor
+	slowMatch       time.Duration
+	rejectWhenFull  bool
+	userAgent       string
+	eventMode       bool
+	dedupHeader     string
+	dedup           *dedupCache // nil unless DedupHeader is set
+	flushLatency    latencyHistogram
+	slowFlush       time.Duration
+	countPath       jsonPath           // nil unless CountJSONPath is set
+	resetRequests   chan chan struct{} // Reset requests, closed by the batchProcessor once reset
+}
+
+// Entry is the activity of requests sent to the remote address, the batches handed to the OnFlush hook
+// and to the Encoder are made of entries
+type Entry struct {
+	RequestId  string `json:"request_id"`
+	Count      int    `json:"count"`
+	Method     string `json:"method"` // HTTP method of the request
+	Body       string `json:"body,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`  // RFC3339 minute the entry was recorded in
+	Pattern    string `json:"pattern,omitempty"` // name of the matching named pattern
+	ReadCount  int    `json:"read_count,omitempty"`
+	WriteCount int    `json:"write_count,omitempty"`
+	Type       string `json:"type,omitempty"`   // connection type of upgraded or streaming connections
+	Tenant     string `json:"tenant,omitempty"` // tenant of the request read from the TenantHeader
+	ClientIP   string `json:"client_ip,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"` // RFC3339 time the request was recorded at in EventMode
+	Path       string `json:"path,omitempty"`      // request path in EventMode
+	enqueued   int64  // unix nanoseconds the entry was enqueued at when MaxEntryAge is set, it isn't sent
 }
 
-// loggingRequestDto used to send request to the third party to save no of requests
-type activityRequestDto struct {
-	RequestId string `json:"request_id"`
-	Count     int    `json:"count"`
+// namedPattern is a compiled pattern of Config.Patterns
+type namedPattern struct {
+	name    string
+	pattern *regexp.Regexp
 }
 
 // implement buffer pool using the sync.Pool type,to reduce the allocation when you are encoding JSON
@@ -61,16 +437,52 @@ var bufferPool = sync.Pool{
 	},
 }
 
+// gzipPool reuses the gzip writers compressing the batches, they're reset to the pooled buffer before use
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
 // New created a new  plugin.
-func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+func New(ctx context.Context, next http.Handler, config *Config, name string) (_ http.Handler, err error) {
+	apiKey, err := expandEnv(config.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APIKey: %w", err)
+	}
+	config.APIKey = apiKey
 	if len(config.APIKey) == 0 {
-		return nil, fmt.Errorf("APIKey can't be empty")
+		return nil, ErrEmptyAPIKey
 	}
 	if len(config.Pattern) == 0 {
-		return nil, fmt.Errorf("pattern can't be empty")
+		return nil, ErrEmptyPattern
+	}
+	if len(config.RemoteAddress) == 0 && len(config.RemoteAddresses) == 0 {
+		return nil, ErrEmptyRemoteAddress
+	}
+	remoteAddresses := config.RemoteAddresses
+	if len(config.RemoteAddress) != 0 {
+		remoteAddresses = append([]string{config.RemoteAddress}, remoteAddresses...)
+	}
+	for _, remoteAddress := range remoteAddresses {
+		if err := validateRemoteAddress(remoteAddress); err != nil {
+			return nil, err
+		}
+	}
+	if config.CountBody != nil {
+		if *config.CountBody && config.DisableCounting {
+			return nil, fmt.Errorf("CountBody and DisableCounting can't be set together")
+		}
+		config.DisableCounting = !*config.CountBody
+	}
+	if config.BufferSize < 0 {
+		return nil, fmt.Errorf("BufferSize can't be negative")
 	}
-	if len(config.RemoteAddress) == 0 {
-		return nil, fmt.Errorf("RemoteAddress can't be empty")
+	if config.BatchSize < 0 {
+		return nil, fmt.Errorf("BatchSize can't be negative")
+	}
+	if config.FlushInterval < 0 {
+		return nil, fmt.Errorf("FlushInterval can't be negative")
 	}
 	if config.BufferSize == 0 {
 		config.BufferSize = DefaultLogBufferSize
@@ -78,151 +490,1376 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 	if config.BatchSize == 0 {
 		config.BatchSize = DefaultMaxBatchSize
 	}
+	if config.MaxPendingBatches < 0 {
+		return nil, fmt.Errorf("MaxPendingBatches can't be negative")
+	}
+	if config.FlushJitter < 0 || config.FlushJitter > 1 {
+		return nil, fmt.Errorf("FlushJitter must be between 0 and 1")
+	}
+	if config.MaxBatchBytes < 0 {
+		return nil, fmt.Errorf("MaxBatchBytes can't be negative")
+	}
+	if config.MaxBodySize < 0 {
+		return nil, fmt.Errorf("MaxBodySize can't be negative")
+	}
+	if config.BodyReadTimeout < 0 {
+		return nil, fmt.Errorf("BodyReadTimeout can't be negative")
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = MaxRequestBodySize
+	}
 	if config.FlushInterval == 0 {
 		config.FlushInterval = DefaultBatchFlushInterval
 	}
 
+	parseFailCount := DefaultParseFailureCount
+	if config.ParseFailureCount != nil {
+		if *config.ParseFailureCount < 0 {
+			return nil, fmt.Errorf("ParseFailureCount can't be negative")
+		}
+		parseFailCount = *config.ParseFailureCount
+	}
+
+	scalarCount := DefaultScalarCount
+	if config.ScalarCount != nil {
+		if *config.ScalarCount < 0 {
+			return nil, fmt.Errorf("ScalarCount can't be negative")
+		}
+		scalarCount = *config.ScalarCount
+	}
+
+	switch config.CaptureBody {
+	case "":
+		config.CaptureBody = CaptureBodyNone
+	case CaptureBodyNone, CaptureBodyHash, CaptureBodyFull:
+	default:
+		return nil, fmt.Errorf("CaptureBody must be one of %s, %s or %s", CaptureBodyNone, CaptureBodyHash, CaptureBodyFull)
+	}
+
+	if config.DialTimeout < 0 || config.TLSHandshakeTimeout < 0 || config.ResponseHeaderTimeout < 0 {
+		return nil, fmt.Errorf("DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout can't be negative")
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = DefaultDialTimeout
+	}
+	if config.TLSHandshakeTimeout == 0 {
+		config.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+	if config.ResponseHeaderTimeout == 0 {
+		config.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	}
+
+	if config.Timeout < 0 {
+		return nil, fmt.Errorf("Timeout can't be negative")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	if config.MaxIdleConns < 0 || config.MaxIdleConnsPerHost < 0 || config.IdleConnTimeout < 0 {
+		return nil, fmt.Errorf("MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout can't be negative")
+	}
+	transport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
 	client := &http.Client{
-		Timeout: DefaultTimeout * time.Second,
+		Timeout:   time.Duration(config.Timeout) * time.Second,
+		Transport: transport,
+	}
+	compiledPattern, err := compilePattern(config.Pattern, config.AnchorPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
 	}
-	compiledPattern := regexp.MustCompile(config.Pattern)
 
-	handler := &Activity{
-		logsChannel:     make(chan activityRequestDto, config.BufferSize),
+	flushCtx, cancel := context.WithCancel(ctx)
+	var handler *Activity
+	defer func() {
+		// an invalid setting past this point must not leak the context or the files opened before it
+		if err != nil {
+			cancel()
+			handler.audit.close()
+			handler.overflow.close()
+			transport.CloseIdleConnections()
+		}
+	}()
+	handler = &Activity{
+		ctx:             flushCtx,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+		flushRequests:   make(chan chan struct{}),
+		resizeRequests:  make(chan resizeRequest),
+		resetRequests:   make(chan chan struct{}),
+		maxBodySize:     config.MaxBodySize,
+		bodyReadTimeout: time.Duration(config.BodyReadTimeout) * time.Second,
+		logsChannel:     make(chan Entry, config.BufferSize),
 		next:            next,
 		name:            name,
 		client:          client,
-		compiledPattern: compiledPattern,
-		remoteAddress:   config.RemoteAddress,
+		remoteAddress:   remoteAddresses[0],
+		primary:         &endpoint{address: remoteAddresses[0]},
 		apiKey:          config.APIKey,
 		batchSize:       config.BatchSize,
+		maxBatchBytes:   config.MaxBatchBytes,
+		flushJitter:     config.FlushJitter,
 		flushInterval:   config.FlushInterval,
+		parseFailCount:  parseFailCount,
+		scalarCount:     scalarCount,
+		captureBody:     config.CaptureBody,
+		disableCounting: config.DisableCounting,
+		disableKeying:   config.DisableKeying,
+		timeBucket:      config.TimeBucket,
+		failClosed:      config.FailClosed,
+		anchorPattern:   config.AnchorPattern,
+		traceFlushes:    config.TraceFlushes,
+	}
+	handler.compiledPattern.Store(compiledPattern)
+	handler.SetLogger(nil)
+	if config.BatchSize > config.BufferSize {
+		handler.log().Warn("CONFIG", "batch_size", config.BatchSize, "buffer_size", config.BufferSize,
+			"reason", "BatchSize is above BufferSize, bursts fill up the buffer before a batch")
+	}
+	for _, remoteAddress := range remoteAddresses[1:] {
+		handler.mirrors = append(handler.mirrors, &endpoint{address: remoteAddress})
+	}
+	if config.BreakerThreshold < 0 || config.BreakerCooldown < 0 {
+		return nil, fmt.Errorf("BreakerThreshold and BreakerCooldown can't be negative")
+	}
+	if config.BreakerCooldown == 0 {
+		config.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if config.BreakerThreshold > 0 {
+		for _, e := range append([]*endpoint{handler.primary}, handler.mirrors...) {
+			e.breaker = newCircuitBreaker(config.BreakerThreshold, time.Duration(config.BreakerCooldown)*time.Second)
+		}
+	}
+	handler.pending.max = config.MaxPendingBatches
+	handler.routeBatches, err = newRouteBatches(config)
+	if err != nil {
+		return nil, err
+	}
+	handler.schemaMarker = config.SchemaMarker
+	for patternName, pattern := range config.Patterns {
+		compiled, err := compilePattern(pattern, config.AnchorPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", patternName, err)
+		}
+		handler.namedPatterns = append(handler.namedPatterns, namedPattern{name: patternName, pattern: compiled})
+	}
+	sort.Slice(handler.namedPatterns, func(i, j int) bool {
+		return handler.namedPatterns[i].name < handler.namedPatterns[j].name
+	})
+	listPatterns := make([]namedPattern, 0, len(config.PatternList))
+	for i, pattern := range config.PatternList {
+		compiled, err := compilePattern(pattern, config.AnchorPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PatternList[%d]: %w", i, err)
+		}
+		listPatterns = append(listPatterns, namedPattern{pattern: compiled})
+	}
+	handler.namedPatterns = append(listPatterns, handler.namedPatterns...)
+	if config.DedupTTL < 0 || config.DedupMaxKeys < 0 {
+		return nil, fmt.Errorf("DedupTTL and DedupMaxKeys can't be negative")
+	}
+	if config.DedupTTL == 0 {
+		config.DedupTTL = DefaultDedupTTL
+	}
+	if config.DedupMaxKeys == 0 {
+		config.DedupMaxKeys = DefaultDedupMaxKeys
+	}
+	if len(config.DedupHeader) != 0 {
+		handler.dedupHeader = http.CanonicalHeaderKey(config.DedupHeader)
+		handler.dedup = newDedupCache(time.Duration(config.DedupTTL)*time.Second, config.DedupMaxKeys)
+	}
+	if config.EventMode && config.SketchMode {
+		return nil, fmt.Errorf("EventMode can't be combined with SketchMode")
+	}
+	handler.eventMode = config.EventMode
+	if config.SketchMode {
+		if config.SketchWidth < 0 || config.SketchDepth < 0 || config.SketchMaxKeys < 0 {
+			return nil, fmt.Errorf("SketchWidth, SketchDepth and SketchMaxKeys can't be negative")
+		}
+		if config.SketchWidth == 0 {
+			config.SketchWidth = DefaultSketchWidth
+		}
+		if config.SketchDepth == 0 {
+			config.SketchDepth = DefaultSketchDepth
+		}
+		if config.SketchMaxKeys == 0 {
+			config.SketchMaxKeys = DefaultSketchMaxKeys
+		}
+		handler.sketch = newCountMinSketch(config.SketchWidth, config.SketchDepth, config.SketchMaxKeys)
+	}
+	if len(config.SyncPattern) != 0 {
+		handler.syncPattern, err = regexp.Compile(config.SyncPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SyncPattern: %w", err)
+		}
+	} else if config.FailClosed {
+		return nil, fmt.Errorf("FailClosed requires a SyncPattern")
+	}
+	if len(config.PriorityMethods) != 0 {
+		if config.PriorityBufferSize < 0 {
+			return nil, fmt.Errorf("PriorityBufferSize can't be negative")
+		}
+		if config.PriorityBufferSize == 0 {
+			config.PriorityBufferSize = config.BufferSize
+		}
+		handler.priorityChannel = make(chan Entry, config.PriorityBufferSize)
+		handler.priorityMethods = config.PriorityMethods
+	}
+	for requestId, floor := range config.CountFloors {
+		if floor < 0 {
+			return nil, fmt.Errorf("CountFloors of %s can't be negative", requestId)
+		}
+	}
+	handler.countFloors = config.CountFloors
+	handler.countProxied = config.CountOnlyProxied
+	for _, status := range config.CountOnlyStatus {
+		if status < 100 || status > 999 {
+			return nil, fmt.Errorf("CountOnlyStatus %d isn't a valid status code", status)
+		}
+		if handler.countStatus == nil {
+			handler.countStatus = make(map[int]bool)
+		}
+		handler.countStatus[status] = true
+	}
+
+	if config.MaxRetries < 0 {
+		return nil, fmt.Errorf("MaxRetries can't be negative")
+	}
+	switch config.JitterStrategy {
+	case "":
+		config.JitterStrategy = JitterFull
+	case JitterNone, JitterFull, JitterEqual, JitterDecorrelated:
+	default:
+		return nil, fmt.Errorf("JitterStrategy must be one of %s, %s, %s or %s", JitterNone, JitterFull, JitterEqual, JitterDecorrelated)
+	}
+	for method, class := range config.MethodClasses {
+		if class != MethodClassRead && class != MethodClassWrite {
+			return nil, fmt.Errorf("MethodClasses of %s must be %s or %s", method, MethodClassRead, MethodClassWrite)
+		}
+	}
+	for method, max := range config.MethodMaxCount {
+		if max < 0 {
+			return nil, fmt.Errorf("MethodMaxCount of %s can't be negative", method)
+		}
+	}
+	handler.splitReadWrite = config.SplitReadWrite
+	handler.methodMaxCount = config.MethodMaxCount
+	handler.recordUpgrades = config.RecordUpgrades
+	handler.signingSecret = []byte(config.SigningSecret)
+	if len(config.Compression) != 0 && config.Compression != CompressionGzip {
+		return nil, fmt.Errorf("Compression must be %s or empty", CompressionGzip)
+	}
+	handler.compression = config.Compression
+	if config.SampleRate != nil {
+		if *config.SampleRate < 0 || *config.SampleRate > 1 {
+			return nil, fmt.Errorf("SampleRate must be between 0 and 1")
+		}
+		handler.sampler = newSampler(*config.SampleRate, config.ScaleSampledCounts)
+	}
+	if len(config.AuthHeader) == 0 {
+		config.AuthHeader = DefaultAuthHeader
+	}
+	handler.authHeader = config.AuthHeader
+	switch config.FlushMethod {
+	case "":
+		config.FlushMethod = http.MethodPost
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+	default:
+		return nil, fmt.Errorf("FlushMethod %q isn't a known HTTP method", config.FlushMethod)
+	}
+	handler.flushMethod = config.FlushMethod
+	handler.extraHeaders = config.ExtraHeaders
+	if len(config.UserAgent) == 0 {
+		config.UserAgent = fmt.Sprintf("crossover-activity/%s (%s)", Version, name)
+	}
+	handler.userAgent = config.UserAgent
+	handler.authValue = config.APIKey
+	if len(config.AuthScheme) != 0 {
+		handler.authValue = config.AuthScheme + " " + config.APIKey
+	}
+	if len(config.AuditLogPath) != 0 {
+		handler.audit, err = openAuditLog(config.AuditLogPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't open AuditLogPath: %w", err)
+		}
+	}
+	if config.OverflowMaxBytes < 0 {
+		return nil, fmt.Errorf("OverflowMaxBytes can't be negative")
+	}
+	if config.OverflowMaxBytes == 0 {
+		config.OverflowMaxBytes = DefaultOverflowMaxBytes
+	}
+	if len(config.OverflowPath) != 0 {
+		handler.overflow, err = openOverflowQueue(config.OverflowPath, config.OverflowMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("can't open OverflowPath: %w", err)
+		}
+	}
+	handler.tenantHeader = http.CanonicalHeaderKey(config.TenantHeader)
+	handler.defaultTenant = config.DefaultTenant
+	switch config.OverflowPolicy {
+	case "":
+		config.OverflowPolicy = OverflowDropNew
+	case OverflowDropNew, OverflowDropOld:
+	default:
+		return nil, fmt.Errorf("OverflowPolicy must be %s or %s", OverflowDropNew, OverflowDropOld)
+	}
+	handler.dropOld = config.OverflowPolicy == OverflowDropOld
+	handler.rejectWhenFull = config.RejectWhenFull
+	if config.RequeueRejected && config.MaxPendingBatches == 0 {
+		return nil, fmt.Errorf("RequeueRejected requires MaxPendingBatches")
+	}
+	handler.requeueRejected = config.RequeueRejected
+	handler.includeClientIP = config.IncludeClientIP
+	if config.EnqueueRate < 0 {
+		return nil, fmt.Errorf("EnqueueRate can't be negative")
+	}
+	if config.EnqueueBurst < 0 {
+		return nil, fmt.Errorf("EnqueueBurst can't be negative")
+	}
+	if config.EnqueueRate > 0 {
+		handler.limiter = newRateLimiter(config.EnqueueRate, config.EnqueueBurst)
+	}
+	handler.dryRun = config.DryRun
+	if config.MaxEntryAge < 0 {
+		return nil, fmt.Errorf("MaxEntryAge can't be negative")
+	}
+	handler.maxEntryAge = time.Duration(config.MaxEntryAge) * time.Millisecond
+	if config.SlowMatchThreshold < 0 {
+		return nil, fmt.Errorf("SlowMatchThreshold can't be negative")
+	}
+	handler.slowMatch = time.Duration(config.SlowMatchThreshold) * time.Microsecond
+	if config.SlowFlushThreshold < 0 {
+		return nil, fmt.Errorf("SlowFlushThreshold can't be negative")
+	}
+	handler.slowFlush = time.Duration(config.SlowFlushThreshold) * time.Millisecond
+	switch config.CountMode {
+	case "":
+		config.CountMode = CountModeAll
+	case CountModeAll, CountModeRPCIds:
+	default:
+		return nil, fmt.Errorf("CountMode must be %s or %s", CountModeAll, CountModeRPCIds)
+	}
+	handler.countMode = config.CountMode
+	if len(config.CountJSONPath) != 0 {
+		handler.countPath, err = parseJSONPath(config.CountJSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CountJSONPath: %w", err)
+		}
+	}
+	if len(config.Format) == 0 {
+		config.Format = FormatJSONArray
+	}
+	handler.formatEncoder = newEncoder(config.Format)
+	if handler.formatEncoder == nil {
+		return nil, fmt.Errorf("Format must be %s or %s", FormatJSONArray, FormatNDJSON)
+	}
+	handler.SetEncoder(nil)
+	if config.FlushConcurrency < 0 {
+		return nil, fmt.Errorf("FlushConcurrency can't be negative")
+	}
+	if config.FlushConcurrency == 0 {
+		config.FlushConcurrency = 1
+	}
+	if config.MaxWorkerGoroutines < 0 {
+		return nil, fmt.Errorf("MaxWorkerGoroutines can't be negative")
+	}
+	if config.MaxWorkerGoroutines > 0 {
+		handler.workers = newWorkerPool(config.MaxWorkerGoroutines, nil)
+	}
+	if config.FlushConcurrency > 1 {
+		handler.flushWorkers = newWorkerPool(config.FlushConcurrency, handler.workers)
+	}
+	handler.readBody = !config.DisableCounting || config.CaptureBody != CaptureBodyNone ||
+		len(config.PriorityMethods) != 0 || config.SplitReadWrite || len(config.MethodMaxCount) != 0
+	handler.methodClasses = config.MethodClasses
+	handler.maxRetries = config.MaxRetries
+	if config.MaxRetryWindow < 0 {
+		return nil, fmt.Errorf("MaxRetryWindow can't be negative")
+	}
+	if config.MaxRetryWindow == 0 {
+		config.MaxRetryWindow = DefaultMaxRetryWindow
+	}
+	handler.retryWindow = time.Duration(config.MaxRetryWindow) * time.Second
+	handler.jitterStrategy = config.JitterStrategy
+	handler.config = *config
+	if config.PipelinedEncoding {
+		handler.encodeChannel = make(chan []Entry, PipelineBufferSize)
+		handler.sendChannel = make(chan encodedBatch, PipelineBufferSize)
+		handler.senderDone = make(chan struct{})
+		go handler.encoder()
+		go handler.sender()
 	}
 	go handler.batchProcessor()
+	if handler.overflow != nil {
+		handler.overflowDone = make(chan struct{})
+		go handler.replayOverflow()
+	}
+	go func() {
+		// tear down the plugin along with its context
+		select {
+		case <-flushCtx.Done():
+			handler.Close(context.Background())
+		case <-handler.done:
+		}
+	}()
+	if config.ValidateSchemaOnStart {
+		handler.workers.Go(func() {
+			if err := handler.ValidateSchema(ctx); err != nil {
+				handler.log().Warn("SCHEMA_VALIDATION", "remote_address", handler.remoteAddress, "error", err)
+			}
+		})
+	}
 	return handler, nil
 }
 
+// pooledBody reads the buffered start of the body followed by the rest of the original body. the transport may
+// still read the body after the handler returns so the buffer goes back to the pool only once the body is closed,
+// a body never closed leaves its buffer to the garbage collector
+type pooledBody struct {
+	io.Reader
+	body io.ReadCloser
+	buf  *bytes.Buffer
+	once sync.Once
+}
+
+func newPooledBody(buf *bytes.Buffer, body io.ReadCloser) *pooledBody {
+	return &pooledBody{
+		Reader: io.MultiReader(bytes.NewReader(buf.Bytes()), body),
+		body:   body,
+		buf:    buf,
+	}
+}
+
+func (b *pooledBody) Close() error {
+	b.once.Do(func() { bufferPool.Put(b.buf) })
+	return b.body.Close()
+}
+
+// expandEnv returns the value of the environment variable NAME if the value is ${NAME}, other values as is
+func expandEnv(value string) (string, error) {
+	if !strings.HasPrefix(value, "${") || !strings.HasSuffix(value, "}") {
+		return value, nil
+	}
+	name := value[2 : len(value)-1]
+	resolved, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s isn't set", name)
+	}
+	return resolved, nil
+}
+
+// validateRemoteAddress checks the remote address is an absolute http or https URL with a host
+func validateRemoteAddress(remoteAddress string) error {
+	remoteURL, err := url.Parse(remoteAddress)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidRemoteURL, remoteAddress, err)
+	}
+	if remoteURL.Scheme != "http" && remoteURL.Scheme != "https" {
+		return fmt.Errorf("%w %q: scheme must be http or https", ErrInvalidRemoteURL, remoteAddress)
+	}
+	if len(remoteURL.Hostname()) == 0 {
+		return fmt.Errorf("%w %q: host can't be empty", ErrInvalidRemoteURL, remoteAddress)
+	}
+	return nil
+}
+
 func (a *Activity) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	requestId, patternName := a.timedRequestKey(req.URL.Path)
+	if len(requestId) == 0 && !a.disableKeying {
+		// requests not matching the pattern aren't recorded
+		a.stats.unmatched.Add(1)
+		a.next.ServeHTTP(rw, req)
+		return
+	}
+	if len(requestId) != 0 {
+		requestId = a.transformRequestId(requestId)
+	}
+	if a.dedup != nil && a.duplicate(requestId, req) {
+		// retries of a recorded request aren't recorded again
+		a.next.ServeHTTP(rw, req)
+		return
+	}
+	logEntry := Entry{RequestId: requestId, Pattern: patternName, Count: 1}
+	if len(a.tenantHeader) != 0 {
+		logEntry.Tenant = req.Header.Get(a.tenantHeader)
+		if len(logEntry.Tenant) == 0 {
+			logEntry.Tenant = a.defaultTenant
+		}
+	}
+	if a.includeClientIP {
+		logEntry.ClientIP = clientIP(req)
+	}
+	if a.eventMode {
+		logEntry.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		logEntry.Path = req.URL.Path
+	}
+
+	if a.recordUpgrades {
+		if connType := connectionType(req); len(connType) != 0 {
+			// long lived connections are recorded once when they're established
+			logEntry.Type = connType
+			a.record(rw, req, logEntry, nil)
+			return
+		}
+	}
+	if !a.readBody {
+		// nothing needs the body, pass the request through untouched
+		a.record(rw, req, logEntry, nil)
+		return
+	}
+
 	buf := bufferPool.Get().(*bytes.Buffer)
 	buf.Reset()
-	defer bufferPool.Put(buf)
 
 	// Limit the size of the request body that we will read
 	//this will guard the plugin from malicious body request by users
-	_, err := io.CopyN(buf, req.Body, MaxRequestBodySize)
-	req.Body.Close()
+	n, err := a.bufferBody(rw, req, buf)
 	if err != nil && err != io.EOF {
-		log.Printf("Error reading request body: %s", err)
+		req.Body.Close()
+		bufferPool.Put(buf)
+		a.log().Error("READ_BODY", "request_id", requestId, "error", err)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			http.Error(rw, "Timeout reading request body", http.StatusRequestTimeout)
+			return
+		}
 		http.Error(rw, "Error reading request body", http.StatusInternalServerError)
 		return
 	}
 
-	bodyReader := bytes.NewReader(buf.Bytes())
-	req.Body = io.NopCloser(bodyReader)
-	clonedRequest := req.Clone(req.Context())
-	clonedRequest.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+	// the next handler reads the buffered bytes followed by the rest of the body beyond the limit.
+	// the buffer is read by record before the next handler is called, which may close the body
+	body := buf.Bytes()
+	if n > a.maxBodySize {
+		// the extra byte tells a body longer than the limit from one exactly at the limit
+		body = body[:a.maxBodySize]
+		a.stats.truncated.Add(1)
+	}
+	req.Body = newPooledBody(buf, req.Body)
+
+	if isGzip(req.Header.Get("Content-Encoding")) {
+		// the body is decompressed for counting only, the next handler still reads it compressed
+		decoded := bufferPool.Get().(*bytes.Buffer)
+		decoded.Reset()
+		defer bufferPool.Put(decoded)
+		if err = a.gunzip(decoded, body); err != nil {
+			a.parseFailure(err)
+			logEntry.Count = a.parseFailCount
+			a.record(rw, req, logEntry, nil)
+			return
+		}
+		body = decoded.Bytes()
+	}
+
+	logEntry.Count = a.requestCount(body, req.Header.Get("Content-Type"))
+	a.record(rw, req, logEntry, body)
+}
+
+// isGzip reports whether the content encoding is gzip
+func isGzip(contentEncoding string) bool {
+	contentEncoding = strings.TrimSpace(contentEncoding)
+	return strings.EqualFold(contentEncoding, "gzip") || strings.EqualFold(contentEncoding, "x-gzip")
+}
+
+// gunzip decompresses up to maxBodySize bytes of the gzipped body into buf, bodies decompressing beyond
+// the limit are truncated like the bodies read beyond it so a small body can't expand unbounded
+func (a *Activity) gunzip(buf *bytes.Buffer, body []byte) error {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if _, err = io.CopyN(buf, reader, a.maxBodySize+1); err != nil && err != io.EOF {
+		return err
+	}
+	if int64(buf.Len()) > a.maxBodySize {
+		buf.Truncate(int(a.maxBodySize))
+		a.stats.truncated.Add(1)
+	}
+	return nil
+}
+
+// bufferBody reads up to maxBodySize bytes of the body, and one more to detect truncated bodies, into buf within
+// the body read timeout. a server ReadTimeout as short already bounds the read so no deadline is set, otherwise the
+// deadline is lifted once the counted part is read, or set to the server ReadTimeout from the start of the read
+// which the server counts from the start of the request, its own deadline can't be read back
+func (a *Activity) bufferBody(rw http.ResponseWriter, req *http.Request, buf *bytes.Buffer) (int64, error) {
+	var serverTimeout time.Duration
+	if server, ok := req.Context().Value(http.ServerContextKey).(*http.Server); ok {
+		serverTimeout = server.ReadTimeout
+	}
+	if a.bodyReadTimeout == 0 || (serverTimeout > 0 && serverTimeout <= a.bodyReadTimeout) {
+		return io.CopyN(buf, req.Body, a.maxBodySize+1)
+	}
+
+	start := time.Now()
+	controller := http.NewResponseController(rw)
+	if controller.SetReadDeadline(start.Add(a.bodyReadTimeout)) != nil {
+		return io.CopyN(buf, req.Body, a.maxBodySize+1)
+	}
+	n, err := io.CopyN(buf, req.Body, a.maxBodySize+1)
+	if err != nil && err != io.EOF {
+		// the request is rejected, the deadline bounds the discard of the rest of the body by the server
+		return n, err
+	}
+	restored := time.Time{}
+	if serverTimeout > 0 {
+		restored = start.Add(serverTimeout)
+	}
+	_ = controller.SetReadDeadline(restored)
+	return n, err
+}
+
+// clientIP returns the leftmost X-Forwarded-For address, the originating client, or the remote address without its port
+func clientIP(req *http.Request) string {
+	if forwarded := req.Header.Get("X-Forwarded-For"); len(forwarded) != 0 {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if first = strings.TrimSpace(first); len(first) != 0 {
+			return first
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		// no port
+		return req.RemoteAddr
+	}
+	return host
+}
 
-	// Create log entry
-	logEntry := activityRequestDto{
-		RequestId: a.requestKey(clonedRequest.URL.Path),
-		Count:     requestCount(clonedRequest),
+// record completes the log entry of the request and records it around serving the request
+func (a *Activity) record(rw http.ResponseWriter, req *http.Request, logEntry Entry, body []byte) {
+	logEntry.Method = req.Method
+	logEntry.Body = a.capturedBody(body)
+	var methods []string
+	if a.priorityChannel != nil || a.splitReadWrite || len(a.methodMaxCount) != 0 {
+		methods = rpcMethods(body, a.countMode == CountModeRPCIds)
+	}
+	if len(a.methodMaxCount) != 0 {
+		methods = a.capMethods(&logEntry, methods)
+	}
+	if a.splitReadWrite {
+		a.splitCount(&logEntry, methods)
+	}
+	if floor, ok := a.countFloors[logEntry.RequestId]; ok && logEntry.Count < floor {
+		// the calls the floor adds aren't classified, they're reads
+		logEntry.ReadCount += floor - logEntry.Count
+		logEntry.Count = floor
+	}
+	if a.timeBucket {
+		logEntry.Bucket = time.Now().UTC().Truncate(time.Minute).Format(time.RFC3339)
+	}
+
+	// critical paths are recorded before being served, bounded by the client request context
+	if a.syncPattern != nil && a.syncPattern.MatchString(req.URL.Path) {
+		err := a.flushPending(withTraceContext(req.Context(), req), &pendingBatch{entries: []Entry{logEntry}})
+		if err == nil {
+			a.recorded(logEntry.RequestId, req)
+			a.next.ServeHTTP(rw, req)
+			return
+		}
+		a.log().Error("SYNC_FLUSH", "request_id", logEntry.RequestId, "status", statusCode(err), "error", err)
+		a.stats.failedFlushes.Add(1)
+		a.stats.lastFlushFailed.Store(true)
+		a.stats.setError(err)
+		if a.failClosed {
+			http.Error(rw, "Error recording request activity", http.StatusServiceUnavailable)
+			return
+		}
+		// fallback to the batch so the activity is recorded later
+	}
+
+	if a.countProxied || a.countStatus != nil {
+		recorder := &statusRecorder{ResponseWriter: rw}
+		a.next.ServeHTTP(recorder, req)
+		if !a.countsResponse(recorder) {
+			return
+		}
+		if queued, _ := a.enqueue(logEntry, methods); queued {
+			a.recorded(logEntry.RequestId, req)
+		}
+		return
+	}
+
+	queued, rejected := a.enqueue(logEntry, methods)
+	if queued {
+		a.recorded(logEntry.RequestId, req)
+	}
+	if rejected {
+		a.stats.rejectedRequests.Add(1)
+		rw.Header().Set("Retry-After", strconv.Itoa(a.flushInterval))
+		http.Error(rw, "Activity buffer full", http.StatusServiceUnavailable)
+		return
+	}
+	a.next.ServeHTTP(rw, req)
+}
+
+// countsResponse reports whether the response recorded by the recorder is counted
+func (a *Activity) countsResponse(recorder *statusRecorder) bool {
+	if a.countProxied && !recorder.wroteHeader {
+		// the next handler writing a response through the recorder means the request was proxied
+		return false
+	}
+	if a.countStatus == nil {
+		return true
+	}
+	status := recorder.status
+	if !recorder.wroteHeader {
+		// the server responds 200 once the handler returns without writing
+		status = http.StatusOK
+	}
+	return a.countStatus[status]
+}
+
+// enqueue sends the logEntry to the batchProcessor without blocking and reports whether it was queued, held
+// by the rate limiter included. rejected is set when the channel is full and RejectWhenFull is set, the request
+// must then be rejected
+func (a *Activity) enqueue(logEntry Entry, methods []string) (queued, rejected bool) {
+	if a.closed.Load() || !a.sampler.sample(&logEntry) {
+		return false, false
+	}
+	if a.maxEntryAge > 0 {
+		logEntry.enqueued = time.Now().UnixNano()
+	}
+	allowed, held := a.limiter.allow(logEntry)
+	if !allowed {
+		a.stats.rateLimited.Add(1)
+		return true, false
+	}
+	for _, heldEntry := range held {
+		a.push(heldEntry, false, false)
+	}
+	queued = a.push(logEntry, a.priorityChannel != nil && a.isPriority(methods), a.rejectWhenFull)
+	return queued, !queued && a.rejectWhenFull
+}
+
+// push sends the logEntry to the channels without blocking and reports whether it was queued. when the channel
+// is full and the logEntry can't go to the overflow file it's left to the caller if reject is set, dropped otherwise
+func (a *Activity) push(logEntry Entry, priority, reject bool) bool {
+	//send priority logEntry to priorityChannel first, then fallback to logsChannel
+	if priority {
+		select {
+		case a.priorityChannel <- logEntry:
+			a.stats.enqueued.Add(1)
+			return true
+		default:
+		}
 	}
 
 	//send logEntry to logsChannel with select and don't block
+	a.logsMu.RLock()
+	defer a.logsMu.RUnlock()
 	select {
 	case a.logsChannel <- logEntry:
+		a.stats.enqueued.Add(1)
 	default:
-		log.Printf("Dropped some log entries due to full buffer channel")
+		if a.overflow != nil && a.overflow.write(logEntry) {
+			a.stats.overflowed.Add(1)
+			return true
+		}
+		if reject {
+			return false
+		}
+		if a.dropOld && a.replaceOldest(logEntry) {
+			a.stats.enqueued.Add(1)
+			return true
+		}
+		a.stats.dropped.Add(1)
+		a.log().Warn("DROPPED", "request_id", logEntry.RequestId, "reason", "buffer channel full")
+		return false
 	}
+	return true
+}
 
-	a.next.ServeHTTP(rw, req)
+// replaceOldest drops the oldest entry of the full channel to make room for the logEntry without blocking
+// and reports whether the logEntry was sent, it isn't if other entries took the room meanwhile. it's called
+// with logsMu held
+func (a *Activity) replaceOldest(logEntry Entry) bool {
+	select {
+	case oldest := <-a.logsChannel:
+		a.stats.dropped.Add(1)
+		a.log().Warn("DROPPED", "request_id", oldest.RequestId, "reason", "buffer channel full, dropped the oldest entry")
+	default:
+	}
+	select {
+	case a.logsChannel <- logEntry:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPriority reports whether any of the JSON-RPC methods is a priority one
+func (a *Activity) isPriority(methods []string) bool {
+	for _, method := range methods {
+		if matchMethod(method, a.priorityMethods) {
+			return true
+		}
+	}
+	return false
+}
+
+// capMethods drops the calls of each method beyond its max count from the methods and the entry count
+func (a *Activity) capMethods(logEntry *Entry, methods []string) []string {
+	calls := make(map[string]int)
+	capped := make([]string, 0, len(methods))
+	for _, method := range methods {
+		calls[method]++
+		if max, ok := a.methodMaxCount[method]; ok && calls[method] > max {
+			if calls[method] == max+1 {
+				a.stats.methodClamps.Add(1)
+			}
+			logEntry.Count--
+			continue
+		}
+		capped = append(capped, method)
+	}
+	if logEntry.Count < 0 {
+		logEntry.Count = 0
+	}
+	return capped
+}
+
+// splitCount splits the entry count into read and write counts adding up to it. requests that aren't JSON-RPC
+// are reads, so are the requests whose count doesn't come from their calls, e.g. counted by a BodyCounter
+func (a *Activity) splitCount(logEntry *Entry, methods []string) {
+	writes := 0
+	for _, method := range methods {
+		if methodClass(method, a.methodClasses) == MethodClassWrite {
+			writes++
+		}
+	}
+	if len(methods) != logEntry.Count {
+		writes = 0
+	}
+	logEntry.WriteCount = writes
+	logEntry.ReadCount = logEntry.Count - writes
 }
 
 // batchProcessor runs in a separate goroutine and batches logs.
 func (a *Activity) batchProcessor() {
-	var batch []activityRequestDto
-	flushTimer := time.NewTimer(time.Duration(a.flushInterval) * time.Second)
+	flushTimer := time.NewTimer(a.flushDelay(a.flushInterval))
+	a.startRouteTimers()
+	var ageExpired <-chan time.Time
+	if a.maxEntryAge > 0 {
+		a.ageTimer = time.NewTimer(a.maxEntryAge)
+		a.stopAgeTimer()
+		ageExpired = a.ageTimer.C
+	}
 	for {
+		// drain priority entries before the normal ones
 		select {
+		case logEntry := <-a.priorityChannel:
+			a.addEntry(logEntry)
+			continue
+		default:
+		}
+
+		select {
+		case logEntry := <-a.priorityChannel:
+			a.addEntry(logEntry)
 		case logEntry := <-a.logsChannel:
-			batch = append(batch, logEntry)
-			if len(batch) >= a.batchSize {
-				a.flushLogs(batch)
-				batch = nil // clear the batch
-			}
+			a.addEntry(logEntry)
 		case <-flushTimer.C:
-			if len(batch) > 0 {
-				a.flushLogs(batch)
-				batch = nil // clear the batch
-			}
-			flushTimer.Reset(time.Duration(a.flushInterval) * time.Second)
+			a.drainLimiter()
+			a.flushSketch()
+			a.flushBatch()
+			flushTimer.Reset(a.flushDelay(a.flushInterval))
+		case <-ageExpired:
+			a.flushBatch()
+		case r := <-a.routeExpired:
+			a.flushRoute(r)
+			r.timer.Reset(a.flushDelay(r.flushInterval))
+		case flushed := <-a.flushRequests:
+			a.flushBuffered()
+			close(flushed)
+		case r := <-a.resizeRequests:
+			a.swapLogs(r.logs)
+			close(r.done)
+		case reset := <-a.resetRequests:
+			a.discard()
+			close(reset)
+		case <-a.done:
+			flushTimer.Stop()
+			a.drain()
+			close(a.stopped)
+			return
+		}
+	}
+}
+
+// flushDelay returns the flush interval, in seconds, randomized by the flush jitter
+func (a *Activity) flushDelay(seconds int) time.Duration {
+	interval := time.Duration(seconds) * time.Second
+	if a.flushJitter == 0 {
+		return interval
+	}
+	spread := time.Duration(float64(interval) * a.flushJitter)
+	return randDuration(interval-spread, interval+spread)
+}
+
+// flushSketch moves the sketch approximate counts to the batch
+func (a *Activity) flushSketch() {
+	if a.sketch != nil {
+		a.batch = append(a.batch, a.sketch.drain()...)
+	}
+}
+
+// addEntry adds the entry to the batch and flushes it once it's full
+func (a *Activity) addEntry(logEntry Entry) {
+	if a.sketch != nil {
+		a.sketch.add(logEntry.RequestId, logEntry.Count)
+		return
+	}
+	if r, ok := a.routeBatches[logEntry.Pattern]; ok {
+		a.addRouteEntry(r, logEntry)
+		return
+	}
+	a.batch = append(a.batch, logEntry)
+	if a.maxBatchBytes > 0 {
+		a.batchBytes += entrySize(logEntry)
+	}
+	a.stats.batchLen.Store(int64(len(a.batch)))
+	if len(a.batch) >= a.batchSize || (a.maxBatchBytes > 0 && a.batchBytes >= a.maxBatchBytes) {
+		a.flushBatch()
+		return
+	}
+	if a.maxEntryAge > 0 {
+		a.trackAge(logEntry)
+	}
+}
+
+// trackAge flushes the batch once its oldest entry is older than maxEntryAge, entries without
+// an enqueue time, e.g. replayed from the overflow file, are considered enqueued now
+func (a *Activity) trackAge(logEntry Entry) {
+	enqueued := logEntry.enqueued
+	if enqueued == 0 {
+		enqueued = time.Now().UnixNano()
+	}
+	if a.batchOldest != 0 && a.batchOldest <= enqueued {
+		return
+	}
+	a.batchOldest = enqueued
+	remaining := a.maxEntryAge - time.Since(time.Unix(0, enqueued))
+	if remaining <= 0 {
+		a.flushBatch()
+		return
+	}
+	a.stopAgeTimer()
+	a.ageTimer.Reset(remaining)
+}
+
+// stopAgeTimer stops the age timer and drains its channel so a stale expiration doesn't flush the next batch
+func (a *Activity) stopAgeTimer() {
+	if a.ageTimer != nil && !a.ageTimer.Stop() {
+		select {
+		case <-a.ageTimer.C:
+		default:
 		}
 	}
 }
 
-// flushLogs sends a batch of logs to the database.
-func (a *Activity) flushLogs(batch []activityRequestDto) {
-	// Aggregate the data and send it to the database in batches
+// flushBatch flushes the current batch if it's not empty
+func (a *Activity) flushBatch() {
+	if len(a.batch) > 0 {
+		a.flush(a.batch)
+		a.resetBatch()
+	}
+}
+
+// resetBatch clears the batch once it's flushed
+func (a *Activity) resetBatch() {
+	a.batch = nil
+	a.batchBytes = 0
+	a.batchOldest = 0
+	a.stopAgeTimer()
+	a.stats.batchLen.Store(0)
+}
+
+// flush sends the batch together with the pending batches of earlier failed flushes.
+// on failure the batch is kept in memory, bounded by maxPending, to be resent with the next flush
+func (a *Activity) flush(batch []Entry) {
+	if a.encodeChannel != nil {
+		a.encodeChannel <- batch
+		return
+	}
+	if a.flushWorkers != nil {
+		a.flushWorkers.Go(func() { a.flushNow(batch) })
+		return
+	}
+	if a.workers != nil {
+		a.workers.Go(func() { a.flushNow(batch) })
+		return
+	}
+	a.flushNow(batch)
+}
+
+// flushNow sends the batch, then resends the pending batches once the remote address took it,
+// in the calling goroutine
+func (a *Activity) flushNow(batch []Entry) {
+	batches := a.pending.take()
+	if len(batch) != 0 {
+		batches = append([]pendingBatch{{entries: batch}}, batches...)
+	}
+	a.flushBatches(batches)
+}
+
+// flushFailed logs the error of the flush of the given number of entries
+func (a *Activity) flushFailed(err error, entries int) {
+	a.log().Error("FLUSH_LOGS", "entries", entries, "status", statusCode(err), "error", err)
+	a.stats.failedFlushes.Add(1)
+	a.stats.lastFlushFailed.Store(true)
+	a.stats.setError(err)
+}
+
+// flushSucceeded records the batch accepted by the remote address with the response body
+func (a *Activity) flushSucceeded(batch []Entry, size int, body []byte) {
+	if a.dryRun {
+		a.stats.dryRunBatches.Add(1)
+		a.stats.dryRunEntries.Add(uint64(len(batch)))
+		return
+	}
+	a.stats.flushedBatches.Add(1)
+	a.stats.flushedEntries.Add(uint64(len(batch)))
+	a.stats.lastFlushFailed.Store(false)
+	a.stats.lastFlushTime.Store(time.Now().UnixNano())
+	if err := a.audit.record(batch, size); err != nil {
+		a.log().Error("AUDIT_LOG", "entries", len(batch), "error", err)
+	}
+	a.counterSink.record(batch, a.checkAcceptance(batch, body))
+}
+
+// flushLogs sends a batch of logs to the database with its idempotency key, and to the mirrors if mirror is set.
+func (a *Activity) flushLogs(ctx context.Context, batch []Entry, idempotencyKey string, mirror bool) error {
+	payload, contentType, err := a.encodeBatch(batch)
+	if err != nil {
+		return err
+	}
+	defer bufferPool.Put(payload)
+	body, err := a.send(ctx, payload.Bytes(), contentType, idempotencyKey, mirror)
+	a.notifyFlush(batch, err)
+	if err != nil {
+		return err
+	}
+	a.flushSucceeded(batch, payload.Len(), body)
+	return nil
+}
+
+// postBatch posts the batch to the remote address and returns the response body of a successful call
+func (a *Activity) postBatch(ctx context.Context, batch []Entry) ([]byte, error) {
+	payload, contentType, err := a.encodeBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+	defer bufferPool.Put(payload)
+	idempotencyKey, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	return a.send(ctx, payload.Bytes(), contentType, idempotencyKey, false)
+}
+
+// encodeBatch encodes the batch into a buffer of the pool with the configured encoder and returns the content type
+// of the payload, the caller puts the buffer back once it's sent
+func (a *Activity) encodeBatch(batch []Entry) (*bytes.Buffer, string, error) {
 	// Get a buffer from the pool and reset it back
 	buffer := bufferPool.Get().(*bytes.Buffer)
 	buffer.Reset()
-	defer bufferPool.Put(buffer)
 
-	encoder := json.NewEncoder(buffer)
-	err := encoder.Encode(batch)
+	var contentType string
+	var err error
+	if a.compression == CompressionGzip {
+		gzipWriter := gzipPool.Get().(*gzip.Writer)
+		gzipWriter.Reset(buffer)
+		contentType, err = a.currentEncoder().Encode(gzipWriter, a.payloadEntries(batch))
+		if closeErr := gzipWriter.Close(); err == nil {
+			err = closeErr
+		}
+		gzipPool.Put(gzipWriter)
+	} else {
+		contentType, err = a.currentEncoder().Encode(buffer, a.payloadEntries(batch))
+	}
 	if err != nil {
-		log.Printf("FLUSH_LOGS: %s", err.Error())
-		return
+		bufferPool.Put(buffer)
+		return nil, "", err
 	}
-	httpReq, err := http.NewRequest(http.MethodPost, a.remoteAddress, buffer)
+	return buffer, contentType, nil
+}
+
+// sendPayload posts the encoded payload to the address and returns the response body of a successful call
+func (a *Activity) sendPayload(ctx context.Context, address string, payload []byte, contentType, idempotencyKey string) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, a.flushMethod, address, bytes.NewReader(payload))
 	if err != nil {
-		log.Printf("FLUSH_LOGS: %s", err.Error())
-		return
+		return nil, err
+	}
+	httpReq.Header.Set("User-Agent", a.userAgent)
+	for name, value := range a.extraHeaders {
+		httpReq.Header.Set(name, value)
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	if a.traceFlushes {
+		if err = setTraceContext(ctx, httpReq); err != nil {
+			return nil, err
+		}
+	}
+	if a.compression == CompressionGzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	httpReq.Header.Set(a.authHeader, a.authValue)
+	if len(a.signingSecret) != 0 {
+		if err = a.signRequest(httpReq, payload); err != nil {
+			return nil, err
+		}
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-Api-Key", a.apiKey)
 
+	start := time.Now()
 	httpRes, err := a.client.Do(httpReq)
-	defer httpRes.Body.Close()
+	a.observeFlush(address, time.Since(start))
 	if err != nil {
-		log.Printf("FLUSH_LOGS: %s", err.Error())
-		return
+		return nil, err
 	}
+	defer httpRes.Body.Close()
 
+	bodyBytes, _ := io.ReadAll(io.LimitReader(httpRes.Body, MaxResponseBodySize))
 	if httpRes.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(httpRes.Body)
-		log.Printf("unexpected status code: %d, body: %s", httpRes.StatusCode, string(bodyBytes))
-		return
+		return nil, &statusError{code: httpRes.StatusCode, body: string(bodyBytes)}
+	}
+	return bodyBytes, nil
+}
+
+// logDryRun logs the flush call that would have been made with the payload, header values may be secrets so only their names are logged
+func (a *Activity) logDryRun(payload []byte, contentType string) {
+	body := string(payload)
+	if a.compression == CompressionGzip {
+		body = fmt.Sprintf("%d gzip compressed bytes", len(payload))
 	}
+	headers := []string{a.authHeader}
+	for name := range a.extraHeaders {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers[1:])
+	a.log().Info("DRY_RUN", "method", a.flushMethod, "url", a.remoteAddress, "content_type", contentType,
+		"headers", strings.Join(headers, ","), "payload", body)
+}
 
+// statusError is returned when the remote address responds with an unexpected status code
+type statusError struct {
+	code int
+	body string
 }
 
-func (a *Activity) requestKey(path string) string {
-	match := a.compiledPattern.FindStringSubmatch(path)
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d, body: %s", e.code, e.body)
+}
+
+// statusCode returns the status code the remote address responded with, 0 if the error isn't a statusError
+func statusCode(err error) int {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code
+	}
+	return 0
+}
+
+// payloadEntries returns the entries of the batch sent to the remote address, the aggregated batch unless
+// every entry is sent as an event
+func (a *Activity) payloadEntries(batch []Entry) []Entry {
+	if a.eventMode {
+		return batch
+	}
+	return aggregate(batch)
+}
+
+// aggregate collapses the entries sharing the same identity, every field but the counts,
+// by summing their counts. entries keep the order of their first occurrence
+func aggregate(batch []Entry) []Entry {
+	aggregated := make([]Entry, 0, len(batch))
+	index := make(map[Entry]int, len(batch))
+	for _, entry := range batch {
+		key := entry
+		key.Count, key.ReadCount, key.WriteCount, key.enqueued = 0, 0, 0, 0
+		if i, ok := index[key]; ok {
+			aggregated[i].Count += entry.Count
+			aggregated[i].ReadCount += entry.ReadCount
+			aggregated[i].WriteCount += entry.WriteCount
+			continue
+		}
+		index[key] = len(aggregated)
+		aggregated = append(aggregated, entry)
+	}
+	return aggregated
+}
+
+// capturedBody returns the body representation sent with the entry according to the capture mode
+func (a *Activity) capturedBody(body []byte) string {
+	switch a.captureBody {
+	case CaptureBodyHash:
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:])
+	case CaptureBodyFull:
+		return string(body)
+	default:
+		return ""
+	}
+}
+
+// SetPattern replaces the pattern used to extract the request id without restarting the plugin,
+// requests being served concurrently use either the old or the new pattern
+func (a *Activity) SetPattern(pattern string) error {
+	if len(pattern) == 0 {
+		return ErrEmptyPattern
+	}
+	compiledPattern, err := compilePattern(pattern, a.anchorPattern)
+	if err != nil {
+		return err
+	}
+	a.compiledPattern.Store(compiledPattern)
+	return nil
+}
+
+// compilePattern compiles the request id pattern, an anchored pattern only matches the whole path.
+// the pattern is wrapped in a non capturing group so its groups keep their index
+func compilePattern(pattern string, anchor bool) (*regexp.Regexp, error) {
+	if anchor {
+		pattern = "^(?:" + pattern + ")$"
+	}
+	return regexp.Compile(pattern)
+}
+
+// timedRequestKey returns the requestKey of the path, matches slower than slowMatch are logged and counted
+func (a *Activity) timedRequestKey(path string) (string, string) {
+	if a.slowMatch == 0 {
+		return a.requestKey(path)
+	}
+	start := time.Now()
+	requestId, patternName := a.requestKey(path)
+	if elapsed := time.Since(start); elapsed > a.slowMatch {
+		a.stats.slowMatches.Add(1)
+		a.log().Warn("SLOW_MATCH", "path_length", len(path), "pattern", patternName, "elapsed", elapsed)
+	}
+	return requestId, patternName
+}
+
+// requestKey returns the first request id matched in the path, see matchId, and the name of the named pattern that matched it
+func (a *Activity) requestKey(path string) (string, string) {
+	if a.disableKeying {
+		return "", ""
+	}
+	if requestId := matchId(a.compiledPattern.Load().(*regexp.Regexp), path); len(requestId) != 0 {
+		return requestId, ""
+	}
+	for _, named := range a.namedPatterns {
+		if requestId := matchId(named.pattern, path); len(requestId) != 0 {
+			return requestId, named.name
+		}
+	}
+	return "", ""
+}
+
+// matchId returns the group named id, or the first capturing group, of the first match of the pattern in the path
+// it falls back to the whole match if the pattern has no groups or the group didn't capture anything
+func matchId(pattern *regexp.Regexp, path string) string {
+	match := pattern.FindStringSubmatch(path)
 	if len(match) == 0 {
 		return ""
 	}
+	group := pattern.SubexpIndex(IdGroupName)
+	if group == -1 {
+		group = 1
+	}
+	if group < len(match) && len(match[group]) != 0 {
+		return match[group]
+	}
 	return match[0]
 }
 
-func requestCount(req *http.Request) (count int) {
-	contentType := req.Header.Get("Content-Type")
-	if contentType != "application/json" {
-		// if it's not of type json default to 1 and return before reading the body
+// requestCount counts the requests in the buffered body of the given content type
+func (a *Activity) requestCount(body []byte, contentType string) (count int) {
+	if a.disableCounting {
 		return 1
 	}
+	if counter := a.bodyCounters.counter(contentType); counter != nil {
+		return counter(body)
+	}
+	if !isJSON(contentType) {
+		// if it's not of type json default to 1 and return before decoding the body
+		return 1
+	}
+	if a.countPath != nil {
+		if requests, ok := a.countPath.array(body); ok {
+			if a.countMode == CountModeRPCIds {
+				return rpcIdCount(requests)
+			}
+			return len(requests)
+		}
+	}
+	if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) != 0 && trimmed[0] == '{' {
+		if a.countMode == CountModeAll {
+			// a single call, the most common request, is counted without decoding it
+			if json.Valid(trimmed) {
+				return 1
+			}
+			// only a malformed body pays for the decode telling what's wrong with it
+			err := json.Unmarshal(trimmed, new(json.RawMessage))
+			a.parseFailure(err)
+			return a.parseFailCount
+		}
+		var call map[string]interface{}
+		if err := json.NewDecoder(bytes.NewReader(trimmed)).Decode(&call); err != nil {
+			a.parseFailure(err)
+			return a.parseFailCount
+		}
+		return rpcIdCount([]interface{}{call})
+	}
 
-	decoder := json.NewDecoder(req.Body)
+	decoder := json.NewDecoder(bytes.NewReader(body))
 	var requests []interface{}
 	err := decoder.Decode(&requests)
 
-	io.Copy(io.Discard, req.Body)
-	req.Body.Close()
-
 	if err != nil {
-		//if it fails to decode []objects assume it's a single object then return
-		return 1
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Value != "object" {
+			// valid json scalar like 5, "foo" or true
+			return a.scalarCount
+		}
+		if typeErr != nil || err == io.EOF {
+			// a single object or an empty body is a single request
+			return 1
+		}
+		// malformed json isn't a request that can be served
+		a.parseFailure(err)
+		return a.parseFailCount
+	}
+	if requests == nil {
+		// null is a json scalar too
+		return a.scalarCount
+	}
+	if a.countMode == CountModeRPCIds {
+		return rpcIdCount(requests)
 	}
 	count = len(requests)
 	return count
 }
+
+// isJSON reports whether the media type of the content type is application/json, ignoring its parameters and case
+func isJSON(contentType string) bool {
+	return mediaType(contentType) == "application/json"
+}
+
+// parseFailure records a body that can't be parsed, logging at most once per ParseFailureLogInterval
+func (a *Activity) parseFailure(err error) {
+	failures := a.stats.parseFailures.Add(1)
+	a.stats.setError(err)
+
+	now := time.Now().UnixNano()
+	last := a.lastParseLog.Load()
+	if now-last < int64(ParseFailureLogInterval) || !a.lastParseLog.CompareAndSwap(last, now) {
+		return
+	}
+	a.log().Warn("PARSE_BODY", "failures", failures, "error", err)
+}
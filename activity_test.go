@@ -0,0 +1,187 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAggregatesPerRequestId(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, BatchSize: 1000}, nil)
+
+	ids := []string{"a", "b", "c"}
+	for i := 0; i < 100; i++ {
+		serve(a, "GET", "/"+ids[i%len(ids)], "")
+	}
+	a.Flush()
+
+	c.mu.Lock()
+	batches := c.batches
+	c.mu.Unlock()
+	if len(batches) != 1 || len(batches[0]) != len(ids) {
+		t.Fatalf("batches = %+v, want a batch of an entry per request id", batches)
+	}
+	for id, want := range map[string]int{"a": 34, "b": 33, "c": 33} {
+		if count := c.count(id); count != want {
+			t.Errorf("count of %s = %d, want %d", id, count, want)
+		}
+	}
+}
+
+func TestAggregatesPerMethod(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60}, nil)
+
+	serve(a, "GET", "/node", "")
+	serve(a, "POST", "/node", "")
+	serve(a, "GET", "/node", "")
+	a.Flush()
+
+	counts := map[string]int{}
+	for _, entry := range c.entries() {
+		counts[entry.Method] += entry.Count
+	}
+	if entries := c.entries(); len(entries) != 2 || counts["GET"] != 2 || counts["POST"] != 1 {
+		t.Fatalf("entries = %+v, want GET 2 and POST 1 in separate entries", entries)
+	}
+}
+
+func TestBodyTruncation(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		size      int
+		truncated uint64
+	}{
+		{name: "under the limit", size: 5},
+		{name: "at the limit", size: 10},
+		{name: "over the limit", size: 11, truncated: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var forwarded int
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				forwarded = len(body)
+			})
+			a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", MaxBodySize: 10}, next)
+
+			serve(a, "POST", "/node", strings.Repeat("a", test.size))
+			if forwarded != test.size {
+				t.Fatalf("forwarded %d bytes, want %d", forwarded, test.size)
+			}
+			if truncated := a.Stats().Truncated; truncated != test.truncated {
+				t.Fatalf("truncated = %d, want %d", truncated, test.truncated)
+			}
+		})
+	}
+}
+
+// serveConcurrently serves requests to the path from goroutines while fn runs, then returns the requests served
+func serveConcurrently(a *Activity, path string, goroutines int, fn func()) int {
+	stop := make(chan struct{})
+	served := make([]int, goroutines)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				serve(a, "POST", path, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call"}`, i))
+				served[i]++
+			}
+		}()
+	}
+	fn()
+	close(stop)
+	wg.Wait()
+	total := 0
+	for _, n := range served {
+		total += n
+	}
+	return total
+}
+
+func TestSetPatternWhileServing(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, BatchSize: 1000}, nil)
+
+	served := serveConcurrently(a, "/node/blocks", 4, func() {
+		for i := 0; i < 20; i++ {
+			pattern := "^/([^/]+)"
+			if i%2 == 1 {
+				pattern = "^/[^/]+/([^/]+)"
+			}
+			if err := a.SetPattern(pattern); err != nil {
+				t.Error(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	a.Flush()
+	if count := c.count("node") + c.count("blocks"); count != served {
+		t.Errorf("count = %d, want the %d requests served", count, served)
+	}
+}
+
+func TestResizeWhileServing(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, BatchSize: 1000, BufferSize: 16}, nil)
+
+	served := serveConcurrently(a, "/node", 4, func() {
+		for _, size := range []int{1, 64, 2, 1024, 8} {
+			if err := a.Resize(size); err != nil {
+				t.Error(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	a.Flush()
+	if count, dropped := c.count("node"), int(a.Stats().Dropped); count+dropped != served {
+		t.Errorf("count %d and dropped %d, want the %d requests served", count, dropped, served)
+	}
+}
+
+func TestPooledBodiesAreNotShared(t *testing.T) {
+	var mu sync.Mutex
+	mismatches := 0
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != req.Header.Get("X-Body") {
+			mu.Lock()
+			mismatches++
+			mu.Unlock()
+		}
+	})
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", FlushInterval: 60}, next)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				body := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call"}`, i*1000+j)
+				req := httptest.NewRequest("POST", "/node", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Body", body)
+				a.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}()
+	}
+	wg.Wait()
+	if mismatches != 0 {
+		t.Errorf("%d requests forwarded another body", mismatches)
+	}
+}
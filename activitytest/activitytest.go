@@ -0,0 +1,150 @@
+// Package activitytest runs the activity middleware against a local collector so tests can push requests
+// through ServeHTTP and inspect the flushed batches without wiring the pipeline by hand
+package activitytest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	crossover_activity "github.com/kotalco/crossover-activity"
+)
+
+// Entry is a flushed entry as received by the collector
+type Entry struct {
+	RequestId  string `json:"request_id"`
+	Count      int    `json:"count"`
+	Method     string `json:"method"`
+	Body       string `json:"body,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`
+	Pattern    string `json:"pattern,omitempty"`
+	ReadCount  int    `json:"read_count,omitempty"`
+	WriteCount int    `json:"write_count,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	ClientIP   string `json:"client_ip,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	Path       string `json:"path,omitempty"`
+}
+
+// Harness is an Activity flushing to a collector served by an httptest server
+type Harness struct {
+	Activity *crossover_activity.Activity
+	Server   *httptest.Server
+
+	mu      sync.Mutex
+	batches [][]Entry
+	flushed chan []Entry
+}
+
+// New starts a collector and an Activity flushing to it with the config, RemoteAddress is set to the
+// collector and APIKey defaults to "test". next serves the requests, it responds 200 when nil
+func New(config *crossover_activity.Config, next http.Handler) (*Harness, error) {
+	if next == nil {
+		next = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	}
+	h := &Harness{flushed: make(chan []Entry, 1024)}
+	h.Server = httptest.NewServer(http.HandlerFunc(h.collect))
+
+	config.RemoteAddress = h.Server.URL
+	config.RemoteAddresses = nil
+	if len(config.APIKey) == 0 {
+		config.APIKey = "test"
+	}
+	handler, err := crossover_activity.New(context.Background(), next, config, "activitytest")
+	if err != nil {
+		h.Server.Close()
+		return nil, err
+	}
+	h.Activity = handler.(*crossover_activity.Activity)
+	return h, nil
+}
+
+// collect records the batches flushed to the collector
+func (h *Harness) collect(rw http.ResponseWriter, req *http.Request) {
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+
+	var batch []Entry
+	if req.Header.Get("Content-Type") == "application/x-ndjson" {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(nil, 64*1024*1024)
+		for scanner.Scan() {
+			var entry Entry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+			batch = append(batch, entry)
+		}
+	} else if err := json.NewDecoder(body).Decode(&batch); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	h.batches = append(h.batches, batch)
+	h.mu.Unlock()
+	select {
+	case h.flushed <- batch:
+	default:
+	}
+}
+
+// Serve serves the request through the Activity and returns the recorded response
+func (h *Harness) Serve(req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	h.Activity.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// WaitForFlush returns the next batch received by the collector, or an error once the timeout is over
+func (h *Harness) WaitForFlush(timeout time.Duration) ([]Entry, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case batch := <-h.flushed:
+		return batch, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("no flush within %s", timeout)
+	}
+}
+
+// Flush flushes the buffered entries and returns the entries of every batch received by the collector so far
+func (h *Harness) Flush() []Entry {
+	h.Activity.Flush()
+	return h.Entries()
+}
+
+// Entries returns the entries of every batch received by the collector so far
+func (h *Harness) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var entries []Entry
+	for _, batch := range h.batches {
+		entries = append(entries, batch...)
+	}
+	return entries
+}
+
+// Close closes the Activity, flushing the remaining entries, then the collector
+func (h *Harness) Close() error {
+	err := h.Activity.Close(context.Background())
+	h.Server.Close()
+	return err
+}
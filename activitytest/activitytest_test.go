@@ -0,0 +1,42 @@
+package activitytest_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	crossover_activity "github.com/kotalco/crossover-activity"
+	"github.com/kotalco/crossover-activity/activitytest"
+)
+
+func TestEventModeEntries(t *testing.T) {
+	h, err := activitytest.New(&crossover_activity.Config{Pattern: "^/([^/]+)", FlushInterval: 60, EventMode: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.Serve(httptest.NewRequest("GET", "/node/blocks", nil))
+	entries := h.Flush()
+	if len(entries) != 1 || entries[0].Path != "/node/blocks" || len(entries[0].Timestamp) == 0 {
+		t.Fatalf("entries = %+v, want the event of /node/blocks with its timestamp", entries)
+	}
+}
+
+func TestWaitForFlush(t *testing.T) {
+	h, err := activitytest.New(&crossover_activity.Config{Pattern: "^/([^/]+)", BatchSize: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.Serve(httptest.NewRequest("GET", "/node", nil))
+	h.Serve(httptest.NewRequest("GET", "/node", nil))
+	batch, err := h.WaitForFlush(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 1 || batch[0].RequestId != "node" || batch[0].Count != 2 {
+		t.Fatalf("batch = %+v, want the node entry counting both requests", batch)
+	}
+}
@@ -0,0 +1,37 @@
+package activitytest_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	crossover_activity "github.com/kotalco/crossover-activity"
+	"github.com/kotalco/crossover-activity/activitytest"
+)
+
+func Example() {
+	h, err := activitytest.New(&crossover_activity.Config{Pattern: "^/([^/]+)", BatchSize: 2}, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer h.Close()
+
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"eth_call"},{"jsonrpc":"2.0","id":2,"method":"eth_chainId"}]`
+	for _, path := range []string{"/mainnet", "/goerli"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(batch))
+		req.Header.Set("Content-Type", "application/json")
+		h.Serve(req)
+	}
+
+	flushed, err := h.WaitForFlush(time.Second)
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range flushed {
+		fmt.Println(entry.RequestId, entry.Count)
+	}
+	// Output:
+	// mainnet 2
+	// goerli 2
+}
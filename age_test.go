@@ -0,0 +1,26 @@
+package crossover_activity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxEntryAge(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, MaxEntryAge: 100}, nil)
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		serve(a, "GET", "/node", "")
+		waitFor(t, 2*time.Second, func() bool { return remote.count("node") == i+1 })
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+			t.Fatalf("entry flushed after %s, want about the 100ms max age", elapsed)
+		}
+	}
+}
+
+func TestMaxEntryAgeMustNotBeNegative(t *testing.T) {
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", MaxEntryAge: -1}); err == nil {
+		t.Fatal("want an error for a negative MaxEntryAge")
+	}
+}
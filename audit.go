@@ -0,0 +1,123 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRecord summary of a batch accepted by the remote address, appended as a JSON line to the audit log
+type auditRecord struct {
+	Sequence  uint64         `json:"sequence"`
+	Timestamp time.Time      `json:"timestamp"`
+	Entries   int            `json:"entries"`
+	Bytes     int            `json:"bytes"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// auditLog local append only record of the activity reported to the remote address
+type auditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	sequence uint64
+}
+
+// openAuditLog opens the audit log, the sequence carries on from the last record of an existing file
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		var sequence uint64
+		var size int64
+		if sequence, size, err = lastSequence(file, info.Size()); err == nil && size != info.Size() {
+			// drop the partially written last line so the next record starts on a line of its own
+			err = file.Truncate(size)
+		}
+		if err == nil {
+			return &auditLog{file: file, sequence: sequence}, nil
+		}
+	}
+	file.Close()
+	return nil, err
+}
+
+// lastSequence returns the sequence of the last complete record of the file of the size, 0 if it has none, and the
+// size of its complete records. the file is read backwards from its end, a last line without a newline was
+// partially written and isn't one of them
+func lastSequence(file *os.File, size int64) (uint64, int64, error) {
+	var tail []byte
+	for offset := size; offset > 0; {
+		n := int64(4096)
+		if n > offset {
+			n = offset
+		}
+		offset -= n
+		chunk := make([]byte, n)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return 0, 0, err
+		}
+		tail = append(chunk, tail...)
+
+		end := bytes.LastIndexByte(tail, '\n')
+		if end == -1 {
+			continue
+		}
+		start := bytes.LastIndexByte(tail[:end], '\n')
+		if start == -1 && offset > 0 {
+			// the start of the last record is further back
+			continue
+		}
+		var record auditRecord
+		if err := json.Unmarshal(tail[start+1:end], &record); err != nil {
+			return 0, 0, fmt.Errorf("last record: %w", err)
+		}
+		return record.Sequence, offset + int64(end) + 1, nil
+	}
+	return 0, 0, nil
+}
+
+// record appends the summary of the flushed batch and syncs it to disk, a nil audit log records nothing
+func (l *auditLog) record(batch []Entry, size int) error {
+	if l == nil {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, entry := range batch {
+		counts[entry.RequestId] += entry.Count
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sequence++
+	line, err := json.Marshal(auditRecord{
+		Sequence:  l.sequence,
+		Timestamp: time.Now().UTC(),
+		Entries:   len(batch),
+		Bytes:     size,
+		Counts:    counts,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// close closes the audit log file, a nil audit log has nothing to close
+func (l *auditLog) close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,94 @@
+package crossover_activity
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditSequenceCarriesOn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit")
+	for i := 0; i < 2; i++ {
+		audit, err := openAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 3; j++ {
+			// records longer than the chunks the last one is read back with
+			if err := audit.record([]Entry{{RequestId: strings.Repeat("x", 5000), Count: 1}}, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		audit.close()
+	}
+	// a partially written record is skipped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"sequence":99`)
+	file.Close()
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audit.sequence != 6 {
+		t.Errorf("sequence = %d, want 6", audit.sequence)
+	}
+	if err := audit.record([]Entry{{RequestId: strings.Repeat("x", 5000), Count: 1}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	audit.close()
+
+	file, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for sequence := uint64(1); sequence <= 7; sequence++ {
+		if !scanner.Scan() {
+			t.Fatalf("%d records, want 7", sequence-1)
+		}
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Sequence != sequence || record.Counts[strings.Repeat("x", 5000)] != 1 {
+			t.Errorf("record %d has sequence %d", sequence, record.Sequence)
+		}
+	}
+	if scanner.Scan() {
+		t.Errorf("unexpected record %s", scanner.Text())
+	}
+}
+
+func TestInvalidConfigClosesFiles(t *testing.T) {
+	open := func() int {
+		fds, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("no /proc/self/fd:", err)
+		}
+		return len(fds)
+	}
+	dir := t.TempDir()
+	before := open()
+	for i := 0; i < 10; i++ {
+		err := configError(&Config{
+			RemoteAddress: "http://127.0.0.1:1",
+			AuditLogPath:  filepath.Join(dir, "audit"),
+			OverflowPath:  filepath.Join(dir, "overflow"),
+			Format:        "bad",
+		})
+		if err == nil || !strings.Contains(err.Error(), "Format") {
+			t.Fatalf("err = %v, want the Format error", err)
+		}
+	}
+	if after := open(); after > before {
+		t.Errorf("%d files left open by rejected configs", after-before)
+	}
+}
@@ -0,0 +1,75 @@
+package crossover_activity
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuthHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		scheme        string
+		sentHeader    string
+		sentValue     string
+		absentHeaders []string
+	}{
+		{"default", "", "", DefaultAuthHeader, "secret", []string{"Authorization"}},
+		{"bearer", "Authorization", "Bearer", "Authorization", "Bearer secret", []string{DefaultAuthHeader}},
+		{"custom", "X-Ingest-Token", "", "X-Ingest-Token", "secret", []string{DefaultAuthHeader, "Authorization"}},
+	}
+	for _, test := range tests {
+		remote := newRawRemote(t)
+		a := newTestActivity(t, &Config{
+			RemoteAddress: remote.URL,
+			FlushInterval: 60,
+			APIKey:        "secret",
+			AuthHeader:    test.header,
+			AuthScheme:    test.scheme,
+		}, nil)
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		_, header := remote.last()
+		if value := header.Get(test.sentHeader); value != test.sentValue {
+			t.Errorf("%s: %s = %q, want %q", test.name, test.sentHeader, value, test.sentValue)
+		}
+		for _, absent := range test.absentHeaders {
+			if _, ok := header[http.CanonicalHeaderKey(absent)]; ok {
+				t.Errorf("%s: unexpected %s header", test.name, absent)
+			}
+		}
+	}
+}
+
+func TestAPIKeyFromEnvironment(t *testing.T) {
+	t.Setenv("ACTIVITY_API_KEY", "from-env")
+	t.Setenv("ACTIVITY_EMPTY_KEY", "")
+	for _, test := range []struct {
+		apiKey string
+		want   string
+	}{
+		{"literal", "literal"},
+		{"${ACTIVITY_API_KEY}", "from-env"},
+		{"$ACTIVITY_API_KEY", "$ACTIVITY_API_KEY"},
+		{"prefix-${ACTIVITY_API_KEY}", "prefix-${ACTIVITY_API_KEY}"},
+	} {
+		remote := newRawRemote(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, APIKey: test.apiKey}, nil)
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		if _, header := remote.last(); header.Get(DefaultAuthHeader) != test.want {
+			t.Errorf("%q: key = %q, want %q", test.apiKey, header.Get(DefaultAuthHeader), test.want)
+		}
+	}
+
+	err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", APIKey: "${ACTIVITY_MISSING_KEY}"})
+	if err == nil || !strings.Contains(err.Error(), "ACTIVITY_MISSING_KEY") {
+		t.Errorf("err = %v, want the unset variable reported", err)
+	}
+	err = configError(&Config{RemoteAddress: "http://127.0.0.1:1", APIKey: "${ACTIVITY_EMPTY_KEY}"})
+	if !errors.Is(err, ErrEmptyAPIKey) {
+		t.Errorf("err = %v, want %v for an empty variable", err, ErrEmptyAPIKey)
+	}
+}
@@ -0,0 +1,69 @@
+package crossover_activity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const benchBody = `[{"jsonrpc":"2.0","id":1,"method":"eth_call"},{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"}]`
+
+// newBenchActivity creates an Activity flushing to a server accepting every batch
+func newBenchActivity(b *testing.B, config *Config) *Activity {
+	b.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	b.Cleanup(server.Close)
+	config.RemoteAddress, config.APIKey, config.Pattern = server.URL, "test", "^/([^/]+)"
+	handler, err := New(context.Background(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), config, "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	a := handler.(*Activity)
+	b.Cleanup(func() { _ = a.Close(context.Background()) })
+	return a
+}
+
+func benchmarkServeHTTP(b *testing.B, config *Config) {
+	a := newBenchActivity(b, config)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("POST", "/node", strings.NewReader(benchBody))
+			req.Header.Set("Content-Type", "application/json")
+			a.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	benchmarkServeHTTP(b, &Config{})
+}
+
+func BenchmarkServeHTTPPipelinedGzip(b *testing.B) {
+	benchmarkServeHTTP(b, &Config{PipelinedEncoding: true, Compression: CompressionGzip})
+}
+
+func BenchmarkServeHTTPWithoutCounting(b *testing.B) {
+	benchmarkServeHTTP(b, &Config{DisableCounting: true})
+}
+
+func BenchmarkFlushEncode(b *testing.B) {
+	a := newBenchActivity(b, &Config{})
+	batch := make([]Entry, 1000)
+	for i := range batch {
+		batch[i] = Entry{RequestId: "node-" + strconv.Itoa(i%100), Count: 1, Method: "POST"}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		payload, _, err := a.encodeBatch(batch)
+		if err != nil {
+			b.Fatal(err)
+		}
+		bufferPool.Put(payload)
+	}
+}
@@ -0,0 +1,71 @@
+package crossover_activity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialBody serves the activity and writes the request of the body length with the first part of the body
+func dialBody(t *testing.T, a *Activity, length int, first string) net.Conn {
+	t.Helper()
+	server := httptest.NewServer(a)
+	t.Cleanup(server.Close)
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "POST /node HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n%s", length, first)
+	return conn
+}
+
+func TestSlowUploadReachesNextHandler(t *testing.T) {
+	type read struct {
+		body []byte
+		err  error
+	}
+	reads := make(chan read, 1)
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		reads <- read{body, err}
+	})
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", MaxBodySize: 10, BodyReadTimeout: 1}, next)
+
+	// the counted part arrives right away, the rest of the body keeps coming for longer than the timeout
+	body := strings.Repeat("a", 100)
+	conn := dialBody(t, a, len(body), body[:20])
+	for i := 20; i < len(body); i += 20 {
+		time.Sleep(500 * time.Millisecond)
+		fmt.Fprint(conn, body[i:i+20])
+	}
+
+	select {
+	case r := <-reads:
+		if r.err != nil || string(r.body) != body {
+			t.Fatalf("next read %d bytes with %v, want the whole body", len(r.body), r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the next handler didn't read the body")
+	}
+}
+
+func TestStalledCountedBodyTimesOut(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", MaxBodySize: 10, BodyReadTimeout: 1}, nil)
+
+	conn := dialBody(t, a, 100, "aaaaa")
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("status = %d, want 408", resp.StatusCode)
+	}
+}
@@ -0,0 +1,97 @@
+package crossover_activity
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerCooldown seconds the circuit stays open before a flush probes the remote address again
+const DefaultBreakerCooldown = 30
+
+// circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// errCircuitOpen fails the flushes to a remote address while its circuit is open
+var errCircuitOpen = errors.New("circuit breaker open, flush not attempted")
+
+// circuitBreaker stops flushing to a remote address after consecutive failed flushes, once the cooldown is
+// over a single flush probes it: the circuit closes if it succeeds and opens again for another cooldown if it fails
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// allow reports whether a flush can be attempted, a nil breaker allows every flush
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		// this flush is the probe, the others fail fast until it completes
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record records the outcome of an allowed flush
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// reset closes the circuit and forgets the failed flushes, a nil breaker has nothing to reset
+func (b *circuitBreaker) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.openedAt = time.Time{}
+}
+
+// current returns the state of the breaker, closed for a nil breaker
+func (b *circuitBreaker) current() string {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
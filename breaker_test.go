@@ -0,0 +1,81 @@
+package crossover_activity
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b := newCircuitBreaker(2, 20*time.Millisecond)
+	failed := errors.New("failed")
+	expect := func(state string, allowed bool) {
+		t.Helper()
+		if current := b.current(); current != state {
+			t.Fatalf("state = %s, want %s", current, state)
+		}
+		if allow := b.allow(); allow != allowed {
+			t.Fatalf("allow = %v in %s, want %v", allow, state, allowed)
+		}
+	}
+
+	expect(BreakerClosed, true)
+	b.record(failed)
+	expect(BreakerClosed, true)
+	b.record(failed)
+	expect(BreakerOpen, false)
+
+	// the probe fails, the circuit opens for another cooldown
+	time.Sleep(30 * time.Millisecond)
+	expect(BreakerOpen, true)
+	if state := b.current(); state != BreakerHalfOpen {
+		t.Fatalf("state = %s while probing, want half-open", state)
+	}
+	if b.allow() {
+		t.Fatal("a second flush was allowed while probing")
+	}
+	b.record(failed)
+	expect(BreakerOpen, false)
+
+	// the probe succeeds, the circuit closes
+	time.Sleep(30 * time.Millisecond)
+	expect(BreakerOpen, true)
+	b.record(nil)
+	expect(BreakerClosed, true)
+	b.record(failed)
+	expect(BreakerClosed, true)
+}
+
+func TestBreakerStopsFlushesToDeadRemoteAddress(t *testing.T) {
+	c := newCollector(t)
+	c.setStatus(http.StatusInternalServerError)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: c.URL, FlushInterval: 60, BreakerThreshold: 2, BreakerCooldown: 1, MaxPendingBatches: 10,
+	}, nil)
+	breaker := func() string { return a.Stats().Endpoints[0].Breaker }
+
+	for i := 0; i < 2; i++ {
+		serve(a, "GET", "/node", "")
+		a.Flush()
+	}
+	if state, calls := breaker(), len(c.calls()); state != BreakerOpen || calls != 2 {
+		t.Fatalf("breaker %s after %d calls, want open after 2", state, calls)
+	}
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if calls := len(c.calls()); calls != 2 {
+		t.Fatalf("%d calls, want none while the circuit is open", calls)
+	}
+
+	c.setStatus(http.StatusOK)
+	time.Sleep(1100 * time.Millisecond)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if state := breaker(); state != BreakerClosed {
+		t.Fatalf("breaker %s once the probe succeeded, want closed", state)
+	}
+	if count := c.count("node"); count != 4 {
+		t.Fatalf("count = %d, want the pending counts resent", count)
+	}
+}
@@ -0,0 +1,55 @@
+package crossover_activity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeBucketsAggregateSeparately(t *testing.T) {
+	entries := aggregate([]Entry{
+		{RequestId: "node", Count: 1, Bucket: "2024-01-01T10:00:00Z"},
+		{RequestId: "node", Count: 2, Bucket: "2024-01-01T10:01:00Z"},
+		{RequestId: "node", Count: 3, Bucket: "2024-01-01T10:00:00Z"},
+	})
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want one per bucket", entries)
+	}
+	if entries[0].Count != 4 || entries[1].Count != 2 {
+		t.Fatalf("counts = %d, %d, want 4, 2", entries[0].Count, entries[1].Count)
+	}
+}
+
+func TestTimeBucketTagsEntries(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, TimeBucket: true}, nil)
+	before := time.Now().UTC().Truncate(time.Minute)
+	serve(a, "GET", "/node", "")
+	serve(a, "GET", "/node", "")
+	after := time.Now().UTC().Truncate(time.Minute)
+	a.Flush()
+
+	count := 0
+	for _, entry := range remote.entries() {
+		bucket, err := time.Parse(time.RFC3339, entry.Bucket)
+		if err != nil {
+			t.Fatalf("bucket = %q: %v", entry.Bucket, err)
+		}
+		if bucket.Before(before) || bucket.After(after) {
+			t.Fatalf("bucket = %s, want between %s and %s", bucket, before, after)
+		}
+		count += entry.Count
+	}
+	if count != 2 {
+		t.Fatalf("count = %d, want 2", count)
+	}
+}
+
+func TestEntriesWithoutTimeBucket(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if entries := remote.entries(); len(entries) != 1 || len(entries[0].Bucket) != 0 {
+		t.Fatalf("entries = %+v, want no bucket", entries)
+	}
+}
@@ -0,0 +1,51 @@
+package crossover_activity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCaptureBody(t *testing.T) {
+	const body = `[{"method":"eth_blockNumber"},{"method":"eth_chainId"}]`
+	sum := sha256.Sum256([]byte(body))
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", ""},
+		{CaptureBodyNone, ""},
+		{CaptureBodyHash, hex.EncodeToString(sum[:])},
+		{CaptureBodyFull, body},
+	}
+	for _, test := range tests {
+		remote := newCollector(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, CaptureBody: test.mode}, nil)
+		serve(a, "POST", "/node", body)
+		a.Flush()
+		entries := remote.entries()
+		if len(entries) != 1 || entries[0].Count != 2 {
+			t.Fatalf("%q: entries = %+v, want a single entry counting 2", test.mode, entries)
+		}
+		if entries[0].Body != test.want {
+			t.Errorf("%q: body = %q, want %q", test.mode, entries[0].Body, test.want)
+		}
+	}
+}
+
+func TestCaptureBodyFullIsTruncated(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, CaptureBody: CaptureBodyFull, MaxBodySize: 8}, nil)
+	serve(a, "POST", "/node", `{"method":"eth_blockNumber"}`)
+	a.Flush()
+	entries := remote.entries()
+	if len(entries) != 1 || entries[0].Body != `{"method` {
+		t.Fatalf("entries = %+v, want a single entry with the first MaxBodySize bytes of the body", entries)
+	}
+}
+
+func TestCaptureBodyMustBeKnown(t *testing.T) {
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", CaptureBody: "raw"}); err == nil {
+		t.Fatal("want an error for CaptureBody raw")
+	}
+}
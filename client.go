@@ -0,0 +1,82 @@
+package crossover_activity
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	DefaultDialTimeout           = 5  // seconds to establish a connection to the remote address
+	DefaultTLSHandshakeTimeout   = 5  // seconds to complete the TLS handshake
+	DefaultResponseHeaderTimeout = 10 // seconds to wait for the response headers once the request is written
+)
+
+// newTransport builds the transport used to flush logs, split timeouts bound each phase of the call
+func newTransport(config *Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   time.Duration(config.DialTimeout) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = time.Duration(config.TLSHandshakeTimeout) * time.Second
+	transport.ResponseHeaderTimeout = time.Duration(config.ResponseHeaderTimeout) * time.Second
+	// zero keeps the connection reuse of the default transport
+	if config.MaxIdleConns != 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.IdleConnTimeout != 0 {
+		transport.IdleConnTimeout = time.Duration(config.IdleConnTimeout) * time.Second
+	}
+	// negotiate HTTP/2 over TLS with the remote addresses supporting it, custom TLS configs included
+	transport.ForceAttemptHTTP2 = true
+
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// newTLSConfig builds the TLS config presenting the client certificate and trusting the CA bundle,
+// it returns nil when neither is configured so the default TLS config is used
+func newTLSConfig(config *Config) (*tls.Config, error) {
+	if len(config.TLSCertFile) == 0 && len(config.TLSKeyFile) == 0 && len(config.TLSCAFile) == 0 {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(config.TLSCertFile) != 0 || len(config.TLSKeyFile) != 0 {
+		if len(config.TLSCertFile) == 0 || len(config.TLSKeyFile) == 0 {
+			return nil, fmt.Errorf("TLSCertFile and TLSKeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(config.TLSCAFile) != 0 {
+		bundle, err := os.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("TLSCAFile doesn't contain any PEM certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,269 @@
+package crossover_activity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportTimeouts(t *testing.T) {
+	tests := []struct {
+		name                  string
+		config                Config
+		tlsHandshake, headers time.Duration
+	}{
+		{"defaults", Config{}, DefaultTLSHandshakeTimeout * time.Second, DefaultResponseHeaderTimeout * time.Second},
+		{"configured", Config{TLSHandshakeTimeout: 2, ResponseHeaderTimeout: 30}, 2 * time.Second, 30 * time.Second},
+	}
+	for _, test := range tests {
+		config := test.config
+		config.RemoteAddress = "http://127.0.0.1:1"
+		a := newTestActivity(t, &config, nil)
+		transport := a.client.Transport.(*http.Transport)
+		if transport.TLSHandshakeTimeout != test.tlsHandshake || transport.ResponseHeaderTimeout != test.headers {
+			t.Errorf("%s: timeouts = %s, %s, want %s, %s", test.name,
+				transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout, test.tlsHandshake, test.headers)
+		}
+		if transport.DialContext == nil {
+			t.Errorf("%s: want a dialer bounded by DialTimeout", test.name)
+		}
+		if config.DialTimeout == 0 {
+			t.Errorf("%s: DialTimeout not defaulted", test.name)
+		}
+	}
+}
+
+func TestTransportTimeoutsMustNotBeNegative(t *testing.T) {
+	for _, config := range []*Config{{DialTimeout: -1}, {TLSHandshakeTimeout: -1}, {ResponseHeaderTimeout: -1}} {
+		config.RemoteAddress = "http://127.0.0.1:1"
+		if err := configError(config); err == nil {
+			t.Errorf("config %+v: want an error", config)
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	for _, test := range []struct {
+		timeout int
+		want    time.Duration
+	}{
+		{0, DefaultTimeout * time.Second},
+		{30, 30 * time.Second},
+		{2, 2 * time.Second},
+	} {
+		a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", Timeout: test.timeout}, nil)
+		if a.client.Timeout != test.want {
+			t.Errorf("Timeout %d: client timeout = %s, want %s", test.timeout, a.client.Timeout, test.want)
+		}
+	}
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", Timeout: -1}); err == nil {
+		t.Error("want an error for a negative Timeout")
+	}
+}
+
+func TestFlushMethodAndExtraHeaders(t *testing.T) {
+	remote := newRawRemote(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: remote.URL,
+		FlushInterval: 60,
+		FlushMethod:   http.MethodPut,
+		ExtraHeaders:  map[string]string{"X-Tenant": "acme", "X-Source": "traefik"},
+	}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if method := remote.lastMethod(); method != http.MethodPut {
+		t.Fatalf("method = %q, want PUT", method)
+	}
+	_, header := remote.last()
+	if tenant, source := header.Get("X-Tenant"), header.Get("X-Source"); tenant != "acme" || source != "traefik" {
+		t.Fatalf("headers = %q, %q, want acme, traefik", tenant, source)
+	}
+}
+
+func TestFlushMethodMustBeKnown(t *testing.T) {
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", FlushMethod: "SEND"}); err == nil {
+		t.Fatal("want an error for FlushMethod SEND")
+	}
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1"}, nil)
+	if a.flushMethod != http.MethodPost {
+		t.Fatalf("flush method = %q, want POST by default", a.flushMethod)
+	}
+}
+
+// issue creates a certificate for the template signed by the parent, a self-signed one when parent is nil
+func issue(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writePEM writes the PEM block of the DER bytes to a file of the directory and returns its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMutualTLS(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test ca"}, NotAfter: notAfter,
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	serverCert, serverKey := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "collector"}, NotAfter: notAfter,
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientCert, clientKey := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "traefik"}, NotAfter: notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", ca.Raw)
+	certFile := writePEM(t, dir, "cert.pem", "CERTIFICATE", clientCert.Raw)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writePEM(t, dir, "key.pem", "EC PRIVATE KEY", keyDER)
+
+	var flushes atomic.Int32
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		flushes.Add(1)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	remote.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	remote.StartTLS()
+	defer remote.Close()
+
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if n, failed := flushes.Load(), a.Stats().FailedFlushes; n != 1 || failed != 0 {
+		t.Fatalf("flushes = %d, failed = %d, want a flush accepted with the client certificate", n, failed)
+	}
+
+	// without the client certificate the handshake is refused
+	a = newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, TLSCAFile: caFile}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if n, failed := flushes.Load(), a.Stats().FailedFlushes; n != 1 || failed != 1 {
+		t.Fatalf("flushes = %d, failed = %d, want the flush without a client certificate to fail", n, failed)
+	}
+}
+
+func TestInvalidTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range []*Config{
+		{TLSCertFile: garbage},
+		{TLSCertFile: garbage, TLSKeyFile: garbage},
+		{TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: garbage},
+		{TLSCAFile: garbage},
+		{TLSCAFile: filepath.Join(dir, "missing.pem")},
+	} {
+		config.RemoteAddress = "https://127.0.0.1:1"
+		if err := configError(config); err == nil {
+			t.Errorf("config %+v: want an error", config)
+		}
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", MaxIdleConns: 50, MaxIdleConnsPerHost: 20, IdleConnTimeout: 45}, nil)
+	transport := a.client.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 20 || transport.IdleConnTimeout != 45*time.Second {
+		t.Fatalf("transport = %d, %d, %s, want 50, 20, 45s", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if !transport.ForceAttemptHTTP2 {
+		t.Fatal("want HTTP/2 negotiated with the remote addresses supporting it")
+	}
+
+	// zero keeps the connection reuse of the default transport
+	a = newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1"}, nil)
+	transport = a.client.Transport.(*http.Transport)
+	defaults := http.DefaultTransport.(*http.Transport)
+	if transport.MaxIdleConns != defaults.MaxIdleConns || transport.MaxIdleConnsPerHost != defaults.MaxIdleConnsPerHost ||
+		transport.IdleConnTimeout != defaults.IdleConnTimeout {
+		t.Fatalf("transport = %d, %d, %s, want the defaults", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", MaxIdleConnsPerHost: -1}); err == nil {
+		t.Fatal("want an error for a negative MaxIdleConnsPerHost")
+	}
+}
+
+func TestHTTP2Flushes(t *testing.T) {
+	var proto atomic.Value
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		proto.Store(req.Proto)
+	}))
+	remote.EnableHTTP2 = true
+	remote.StartTLS()
+	defer remote.Close()
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", remote.Certificate().Raw)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, TLSCAFile: caFile}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if p, _ := proto.Load().(string); p != "HTTP/2.0" {
+		t.Fatalf("proto = %q, want HTTP/2.0", p)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	for _, test := range []struct {
+		userAgent string
+		want      string
+	}{
+		{"", "crossover-activity/" + Version + " (test)"},
+		{"billing-gateway/2.1", "billing-gateway/2.1"},
+	} {
+		remote := newRawRemote(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, UserAgent: test.userAgent}, nil)
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		if _, header := remote.last(); header.Get("User-Agent") != test.want {
+			t.Errorf("User-Agent = %q, want %q", header.Get("User-Agent"), test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package crossover_activity
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		forwarded  string
+		remoteAddr string
+		want       string
+	}{
+		{"leftmost forwarded", "203.0.113.7, 10.0.0.1, 10.0.0.2", "10.0.0.3:4711", "203.0.113.7"},
+		{"single forwarded", "2001:db8::1", "10.0.0.3:4711", "2001:db8::1"},
+		{"empty leftmost forwarded", " , 10.0.0.1", "192.0.2.1:4711", "192.0.2.1"},
+		{"remote address", "", "192.0.2.1:4711", "192.0.2.1"},
+		{"ipv6 remote address", "", "[2001:db8::2]:4711", "2001:db8::2"},
+		{"remote address without port", "", "192.0.2.1", "192.0.2.1"},
+	} {
+		req := httptest.NewRequest("GET", "/node", nil)
+		req.RemoteAddr = test.remoteAddr
+		if len(test.forwarded) != 0 {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if ip := clientIP(req); ip != test.want {
+			t.Errorf("%s: client ip = %q, want %q", test.name, ip, test.want)
+		}
+	}
+}
+
+func TestIncludeClientIP(t *testing.T) {
+	for _, include := range []bool{true, false} {
+		remote := newCollector(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, IncludeClientIP: include}, nil)
+		for _, remoteAddr := range []string{"192.0.2.1:1000", "192.0.2.2:1000", "192.0.2.1:2000"} {
+			req := httptest.NewRequest("GET", "/node", nil)
+			req.RemoteAddr = remoteAddr
+			a.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		a.Flush()
+
+		counts := map[string]int{}
+		for _, entry := range remote.entries() {
+			counts[entry.ClientIP] += entry.Count
+		}
+		if include && (counts["192.0.2.1"] != 2 || counts["192.0.2.2"] != 1 || len(counts) != 2) {
+			t.Errorf("counts = %v, want an entry per client ip", counts)
+		}
+		if !include && (counts[""] != 3 || len(counts) != 1) {
+			t.Errorf("counts = %v, want a single entry without client ip", counts)
+		}
+	}
+}
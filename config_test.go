@@ -0,0 +1,112 @@
+package crossover_activity
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRemoteAddressValidation(t *testing.T) {
+	for _, remoteAddress := range []string{
+		"http://localhost:8080/activity",
+		"https://collector.example.com",
+		"http://127.0.0.1:1",
+		"https://[::1]:8443/v1/activity?source=traefik",
+	} {
+		if err := configError(&Config{RemoteAddress: remoteAddress}); err != nil {
+			t.Errorf("%q: err = %v, want a valid address", remoteAddress, err)
+		}
+	}
+	for _, remoteAddress := range []string{
+		"collector:8080",
+		"localhost",
+		"/activity",
+		"ftp://collector.example.com",
+		"http://",
+		"https:///activity",
+		"http://collector.example.com/%zz",
+		"http//collector.example.com",
+	} {
+		if err := configError(&Config{RemoteAddress: remoteAddress}); !errors.Is(err, ErrInvalidRemoteURL) {
+			t.Errorf("%q: err = %v, want %v", remoteAddress, err, ErrInvalidRemoteURL)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	valid := func() *Config {
+		return &Config{APIKey: "test", Pattern: "^/([^/]+)", RemoteAddress: "http://127.0.0.1:1"}
+	}
+	for _, test := range []struct {
+		name   string
+		config func(*Config)
+		want   error
+	}{
+		{"empty APIKey", func(config *Config) { config.APIKey = "" }, ErrEmptyAPIKey},
+		{"empty Pattern", func(config *Config) { config.Pattern = "" }, ErrEmptyPattern},
+		{"empty RemoteAddress", func(config *Config) { config.RemoteAddress = "" }, ErrEmptyRemoteAddress},
+		{"invalid RemoteAddress", func(config *Config) { config.RemoteAddress = "collector:8080" }, ErrInvalidRemoteURL},
+		{"invalid mirror", func(config *Config) { config.RemoteAddresses = []string{"ftp://collector"} }, ErrInvalidRemoteURL},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := valid()
+			test.config(config)
+			_, err := New(context.Background(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), config, "test")
+			if !errors.Is(err, test.want) {
+				t.Errorf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	a := newTestActivity(t, valid(), nil)
+	if err := a.SetPattern(""); !errors.Is(err, ErrEmptyPattern) {
+		t.Errorf("SetPattern err = %v, want %v", err, ErrEmptyPattern)
+	}
+}
+
+func TestRemoteAddressesValidation(t *testing.T) {
+	err := configError(&Config{RemoteAddresses: []string{"http://collector.example.com", "collector:8080"}})
+	if !errors.Is(err, ErrInvalidRemoteURL) {
+		t.Fatalf("err = %v, want %v for the invalid mirror", err, ErrInvalidRemoteURL)
+	}
+	if err := configError(&Config{}); !errors.Is(err, ErrEmptyRemoteAddress) {
+		t.Fatalf("err = %v, want %v", err, ErrEmptyRemoteAddress)
+	}
+}
+
+func TestBatchBounds(t *testing.T) {
+	for _, test := range []struct {
+		config Config
+		want   string
+	}{
+		{Config{BufferSize: -1}, "BufferSize"},
+		{Config{BatchSize: -1}, "BatchSize"},
+		{Config{FlushInterval: -1}, "FlushInterval"},
+	} {
+		config := test.config
+		config.RemoteAddress = "http://127.0.0.1:1"
+		if err := configError(&config); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("config %+v: err = %v, want a %s error", test.config, err, test.want)
+		}
+	}
+
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1"}, nil)
+	if stats := a.Stats(); stats.BufferSize != DefaultLogBufferSize || stats.BatchSize != DefaultMaxBatchSize || stats.FlushInterval != DefaultBatchFlushInterval {
+		t.Fatalf("stats = %+v, want the default bounds", stats)
+	}
+}
+
+func TestBatchSizeAboveBufferSizeWarns(t *testing.T) {
+	output := &syncBuffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", BufferSize: 10, BatchSize: 20}, nil)
+	if !strings.Contains(output.String(), "WARNING CONFIG: batch_size=20 buffer_size=10") {
+		t.Fatalf("output = %q, want a warning about BatchSize above BufferSize", output.String())
+	}
+}
@@ -0,0 +1,127 @@
+package crossover_activity
+
+import (
+	"testing"
+)
+
+const jsonType = "application/json"
+
+func TestSingleObjectFastPath(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1"}, nil)
+	for _, test := range []struct {
+		name  string
+		body  string
+		count int
+	}{
+		{"object", `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`, 1},
+		{"array", `[{"jsonrpc":"2.0","id":1},{"jsonrpc":"2.0","id":2}]`, 2},
+		{"whitespace prefixed object", " \r\n\t{\"id\":1}", 1},
+		{"whitespace prefixed array", " \n[{\"id\":1},{\"id\":2},{\"id\":3}]", 3},
+		{"malformed object", `{"jsonrpc":`, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if count := a.requestCount([]byte(test.body), jsonType); count != test.count {
+				t.Errorf("count = %d, want %d", count, test.count)
+			}
+		})
+	}
+	if failures := a.Stats().ParseFailures; failures != 1 {
+		t.Errorf("parse failures = %d, want the malformed object only", failures)
+	}
+
+	// parsing the content type is all a single object costs, as for a body that isn't json
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`)
+	object := testing.AllocsPerRun(100, func() { a.requestCount(body, jsonType) })
+	text := testing.AllocsPerRun(100, func() { a.requestCount(body, "text/plain") })
+	if object > text {
+		t.Errorf("a single object costs %v allocations, want the %v of parsing the content type", object, text)
+	}
+}
+
+func TestRequestCountByBodyShape(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1"}, nil)
+	for _, test := range []struct {
+		name  string
+		body  string
+		count int
+	}{
+		{"single object", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, 1},
+		{"array", `[{"jsonrpc":"2.0","id":1},{"jsonrpc":"2.0","id":2}]`, 2},
+		{"malformed array", `[{"jsonrpc":"2.0","id":1},`, 0},
+		{"malformed object", `{"jsonrpc"}`, 0},
+		{"empty", ``, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if count := a.requestCount([]byte(test.body), jsonType); count != test.count {
+				t.Errorf("count = %d, want %d", count, test.count)
+			}
+		})
+	}
+}
+
+func TestParseFailureCount(t *testing.T) {
+	c := newCollector(t)
+	failCount := 3
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, ParseFailureCount: &failCount}, nil)
+
+	serve(a, "POST", "/node", `[{"jsonrpc":"2.0","id":1},`)
+	serve(a, "POST", "/node", `{"jsonrpc":`)
+	serve(a, "POST", "/node", `{"jsonrpc":"2.0","id":1}`)
+	a.Flush()
+	if failures := a.Stats().ParseFailures; failures != 2 {
+		t.Errorf("parse failures = %d, want 2", failures)
+	}
+	if count := c.count("node"); count != 2*failCount+1 {
+		t.Errorf("count = %d, want %d", count, 2*failCount+1)
+	}
+}
+
+func TestParseFailureCountMustNotBeNegative(t *testing.T) {
+	failCount := -1
+	if err := configError(&Config{ParseFailureCount: &failCount}); err == nil {
+		t.Fatal("a negative ParseFailureCount was accepted")
+	}
+}
+
+func TestScalarCount(t *testing.T) {
+	five := 5
+	for _, test := range []struct {
+		name   string
+		config Config
+		count  int
+	}{
+		{"default", Config{}, 1},
+		{"configured", Config{ScalarCount: &five}, 5},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.RemoteAddress = "http://127.0.0.1:1"
+			a := newTestActivity(t, &config, nil)
+			for _, body := range []string{`true`, `42`, `"x"`, ` null `} {
+				if count := a.requestCount([]byte(body), jsonType); count != test.count {
+					t.Errorf("count of %s = %d, want %d", body, count, test.count)
+				}
+			}
+			if failures := a.Stats().ParseFailures; failures != 0 {
+				t.Errorf("parse failures = %d, scalars aren't malformed", failures)
+			}
+		})
+	}
+}
+
+func TestJSONContentTypes(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1"}, nil)
+	body := []byte(`[{"jsonrpc":"2.0","id":1},{"jsonrpc":"2.0","id":2}]`)
+	for contentType, count := range map[string]int{
+		"application/json":                 2,
+		"application/json; charset=utf-8":  2,
+		"APPLICATION/JSON":                 2,
+		"Application/Json ; Charset=UTF-8": 2,
+		"text/plain":                       1,
+		"application/jsonp":                1,
+	} {
+		if got := a.requestCount(body, contentType); got != count {
+			t.Errorf("count with %q = %d, want %d", contentType, got, count)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package crossover_activity
+
+import (
+	"mime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// BodyCounter counts the requests in the buffered body of a request, the body may be truncated to MaxBodySize
+type BodyCounter func(body []byte) int
+
+// bodyCounters counters of the request bodies by media type, the map is replaced on every
+// registration so requests read it without locking
+type bodyCounters struct {
+	mu       sync.Mutex   // serializes registrations
+	counters atomic.Value // map[string]BodyCounter
+}
+
+func (c *bodyCounters) load() map[string]BodyCounter {
+	counters, _ := c.counters.Load().(map[string]BodyCounter)
+	return counters
+}
+
+// RegisterCounter counts the bodies of the media type, e.g. application/x-www-form-urlencoded, with the counter
+// instead of the built-in counting, JSON bodies included. media types without a counter count as 1, except JSON.
+// a nil counter removes the counter of the media type
+func (a *Activity) RegisterCounter(mediaType string, counter BodyCounter) {
+	mediaType = strings.ToLower(mediaType)
+
+	a.bodyCounters.mu.Lock()
+	defer a.bodyCounters.mu.Unlock()
+	counters := make(map[string]BodyCounter)
+	for registered, registeredCounter := range a.bodyCounters.load() {
+		counters[registered] = registeredCounter
+	}
+	if counter == nil {
+		delete(counters, mediaType)
+	} else {
+		counters[mediaType] = counter
+	}
+	a.bodyCounters.counters.Store(counters)
+}
+
+// counter returns the counter registered for the media type of the content type, nil if there's none
+func (c *bodyCounters) counter(contentType string) BodyCounter {
+	counters := c.load()
+	if len(counters) == 0 {
+		return nil
+	}
+	return counters[mediaType(contentType)]
+}
+
+// mediaType returns the lowercase media type of the content type without its parameters, empty if it's invalid
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
@@ -0,0 +1,51 @@
+package crossover_activity
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRegisterCounter(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	post := func(path, contentType, body string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	const form = "record=a&record=b&record=c&source=upload"
+	post("/before", "application/x-www-form-urlencoded", form)
+	a.RegisterCounter("Application/X-WWW-Form-Urlencoded", func(body []byte) int {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return 1
+		}
+		return len(values["record"])
+	})
+	post("/form", "application/x-www-form-urlencoded; charset=utf-8", form)
+	post("/text", "text/plain", "a\nb")
+	post("/json", jsonType, `[{},{}]`)
+	a.RegisterCounter("application/x-www-form-urlencoded", nil)
+	post("/after", "application/x-www-form-urlencoded", form)
+	a.Flush()
+
+	for id, want := range map[string]int{"before": 1, "form": 3, "text": 1, "json": 2, "after": 1} {
+		if count := remote.count(id); count != want {
+			t.Errorf("count of %s = %d, want %d", id, count, want)
+		}
+	}
+}
+
+func TestRegisterCounterOverridesJSON(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	a.RegisterCounter(jsonType, func(body []byte) int { return 7 })
+	serve(a, "POST", "/node", `[{},{}]`)
+	a.Flush()
+	if count := remote.count("node"); count != 7 {
+		t.Fatalf("count = %d, want the registered counter's 7", count)
+	}
+}
@@ -0,0 +1,103 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDedupTTL     = 60     // seconds a dedup key is remembered
+	DefaultDedupMaxKeys = 100000 // dedup keys remembered at once, the oldest are forgotten first
+)
+
+// dedupCache remembers the dedup keys seen within the ttl, bounded to max keys
+type dedupCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	keys  map[string]time.Time // expiry by key
+	order []dedupKey           // keys by expiry, the ttl being the same for every key
+}
+
+type dedupKey struct {
+	key     string
+	expires time.Time
+}
+
+func newDedupCache(ttl time.Duration, max int) *dedupCache {
+	return &dedupCache{ttl: ttl, max: max, keys: make(map[string]time.Time)}
+}
+
+// contains reports whether the key was remembered within the ttl. a nil cache remembers nothing
+func (c *dedupCache) contains(key string) bool {
+	if c == nil || len(key) == 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.keys[key]
+	return ok && expires.After(time.Now())
+}
+
+// add remembers the key for the ttl, forgetting the expired keys and the oldest ones beyond max
+func (c *dedupCache) add(key string) {
+	if c == nil || len(key) == 0 {
+		return
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.order) > 0 && (!c.order[0].expires.After(now) || len(c.order) >= c.max) {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		// a key added again once expired has a later entry in order
+		if c.keys[oldest.key].Equal(oldest.expires) {
+			delete(c.keys, oldest.key)
+		}
+	}
+	expires := now.Add(c.ttl)
+	c.keys[key] = expires
+	c.order = append(c.order, dedupKey{key: key, expires: expires})
+}
+
+// requestDedupKey returns the key of the request in the dedup cache, empty if dedup is disabled or
+// the request doesn't have the DedupHeader
+func (a *Activity) requestDedupKey(requestId string, req *http.Request) string {
+	if a.dedup == nil {
+		return ""
+	}
+	value := req.Header.Get(a.dedupHeader)
+	if len(value) == 0 {
+		return ""
+	}
+	return requestId + "\x00" + value
+}
+
+// duplicate reports whether a request with the same request id and value of the DedupHeader was recorded
+// within the DedupTTL
+func (a *Activity) duplicate(requestId string, req *http.Request) bool {
+	if !a.dedup.contains(a.requestDedupKey(requestId, req)) {
+		return false
+	}
+	a.stats.deduplicated.Add(1)
+	return true
+}
+
+// recorded remembers the request once its entry is enqueued or flushed, so retries of a request that
+// wasn't recorded, e.g. rejected or not counted because of its status, are recorded
+func (a *Activity) recorded(requestId string, req *http.Request) {
+	a.dedup.add(a.requestDedupKey(requestId, req))
+}
+
+// reset forgets every key, a nil cache has nothing to forget
+func (c *dedupCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = make(map[string]time.Time)
+	c.order = nil
+}
@@ -0,0 +1,59 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDedupWithinTTL(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", DedupHeader: "Idempotency-Key", DedupTTL: 1}, nil)
+	send := func() {
+		req := httptest.NewRequest("GET", "/node", nil)
+		req.Header.Set("Idempotency-Key", "retry")
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send()
+	send()
+	time.Sleep(1100 * time.Millisecond)
+	send()
+	if stats := a.Stats(); stats.Enqueued != 2 || stats.Deduplicated != 1 {
+		t.Fatalf("enqueued = %d, deduplicated = %d, want 2, 1", stats.Enqueued, stats.Deduplicated)
+	}
+}
+
+func TestDedupRetryOfUnrecordedRequest(t *testing.T) {
+	status := http.StatusInternalServerError
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) { rw.WriteHeader(status) })
+	a := newTestActivity(t, &Config{
+		RemoteAddress:   "http://127.0.0.1:1",
+		DedupHeader:     "Idempotency-Key",
+		CountOnlyStatus: []int{http.StatusOK},
+	}, next)
+	send := func() {
+		req := httptest.NewRequest("GET", "/node", nil)
+		req.Header.Set("Idempotency-Key", "retry")
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the failed attempt isn't counted so its retry must be
+	send()
+	status = http.StatusOK
+	send()
+	send()
+	if stats := a.Stats(); stats.Enqueued != 1 || stats.Deduplicated != 1 {
+		t.Fatalf("enqueued = %d, deduplicated = %d, want 1, 1", stats.Enqueued, stats.Deduplicated)
+	}
+}
+
+func TestDedupCacheBounded(t *testing.T) {
+	c := newDedupCache(time.Hour, 2)
+	for _, key := range []string{"a", "b", "c"} {
+		c.add(key)
+	}
+	if c.contains("a") || !c.contains("b") || !c.contains("c") || len(c.keys) != 2 {
+		t.Fatalf("keys = %v, want the 2 newest keys", c.keys)
+	}
+}
@@ -0,0 +1,43 @@
+package crossover_activity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: remote.URL,
+		FlushInterval: 60,
+		DryRun:        true,
+		APIKey:        "secret",
+		ExtraHeaders:  map[string]string{"X-Tenant": "acme"},
+	}, nil)
+	logger := &capturingLogger{}
+	a.SetLogger(logger)
+
+	serve(a, "GET", "/node", "")
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	a.Flush()
+
+	if calls := remote.calls(); len(calls) != 0 {
+		t.Fatalf("calls = %q, want no call in dry run", calls)
+	}
+	stats := a.Stats()
+	if stats.DryRunBatches != 1 || stats.DryRunEntries != 2 || stats.FlushedBatches != 0 || stats.FailedFlushes != 0 {
+		t.Fatalf("stats = %+v, want a single dry run batch and nothing flushed", stats)
+	}
+	records := logger.find("INFO", "DRY_RUN")
+	if len(records) != 1 {
+		t.Fatalf("records = %+v, want the batch logged once and cleared", logger.records)
+	}
+	fields := records[0].fields
+	if fields["url"] != remote.URL || fields["method"] != "POST" || !strings.Contains(fields["payload"].(string), `"request_id":"node"`) {
+		t.Fatalf("fields = %v, want the target and the payload", fields)
+	}
+	if headers := fields["headers"].(string); headers != DefaultAuthHeader+",X-Tenant" || strings.Contains(headers, "secret") {
+		t.Fatalf("headers = %q, want the header names only", headers)
+	}
+}
@@ -0,0 +1,67 @@
+package crossover_activity
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// batch formats
+const (
+	FormatJSONArray = "json-array"
+	FormatNDJSON    = "ndjson"
+)
+
+// Encoder writes the aggregated batch flushed to the remote address and returns the content type of the payload
+type Encoder interface {
+	Encode(w io.Writer, batch []Entry) (contentType string, err error)
+}
+
+// jsonArrayEncoder encodes the batch as a JSON array of entries
+type jsonArrayEncoder struct{}
+
+func (jsonArrayEncoder) Encode(w io.Writer, batch []Entry) (string, error) {
+	return "application/json", json.NewEncoder(w).Encode(batch)
+}
+
+// ndjsonEncoder encodes the batch as newline delimited JSON, an entry per line
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Encode(w io.Writer, batch []Entry) (string, error) {
+	encoder := json.NewEncoder(w)
+	for _, entry := range batch {
+		if err := encoder.Encode(entry); err != nil {
+			return "", err
+		}
+	}
+	return "application/x-ndjson", nil
+}
+
+// newEncoder returns the encoder of the format, nil if the format is unknown
+func newEncoder(format string) Encoder {
+	switch format {
+	case FormatJSONArray:
+		return jsonArrayEncoder{}
+	case FormatNDJSON:
+		return ndjsonEncoder{}
+	}
+	return nil
+}
+
+// encoderValue wraps the Encoder so encoders of different types can be stored in an atomic.Value
+type encoderValue struct {
+	Encoder
+}
+
+// SetEncoder encodes the flushed batches with the encoder instead of the encoder of Format, e.g. for a schema
+// of the remote address the formats don't cover. a nil encoder restores the encoder of Format
+func (a *Activity) SetEncoder(encoder Encoder) {
+	if encoder == nil {
+		encoder = a.formatEncoder
+	}
+	a.batchEncoder.Store(encoderValue{encoder})
+}
+
+// currentEncoder returns the encoder of the flushed batches
+func (a *Activity) currentEncoder() Encoder {
+	return a.batchEncoder.Load().(encoderValue).Encoder
+}
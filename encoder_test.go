@@ -0,0 +1,46 @@
+package crossover_activity_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	crossover_activity "github.com/kotalco/crossover-activity"
+	"github.com/kotalco/crossover-activity/activitytest"
+)
+
+// upperEncoder writes the batch as ndjson with the request ids upper cased
+type upperEncoder struct{}
+
+func (upperEncoder) Encode(w io.Writer, batch []crossover_activity.Entry) (string, error) {
+	encoder := json.NewEncoder(w)
+	for _, entry := range batch {
+		entry.RequestId = strings.ToUpper(entry.RequestId)
+		if err := encoder.Encode(entry); err != nil {
+			return "", err
+		}
+	}
+	return "application/x-ndjson", nil
+}
+
+func TestSetEncoderOutsideThePackage(t *testing.T) {
+	h, err := activitytest.New(&crossover_activity.Config{Pattern: "^/([^/]+)", FlushInterval: 60}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.Activity.SetEncoder(upperEncoder{})
+	h.Serve(httptest.NewRequest("GET", "/node", nil))
+	if entries := h.Flush(); len(entries) != 1 || entries[0].RequestId != "NODE" {
+		t.Fatalf("entries = %+v, want the NODE entry of the custom encoder", entries)
+	}
+
+	h.Activity.SetEncoder(nil)
+	h.Serve(httptest.NewRequest("GET", "/node", nil))
+	if entries := h.Flush(); len(entries) != 2 || entries[1].RequestId != "node" {
+		t.Fatalf("entries = %+v, want the node entry of the Format encoder", entries)
+	}
+}
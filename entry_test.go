@@ -0,0 +1,69 @@
+package crossover_activity
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntrySizeMatchesEncodedEntry(t *testing.T) {
+	long := strings.Repeat("x", 512)
+	for _, test := range []struct {
+		name  string
+		entry Entry
+	}{
+		{"minimal", Entry{RequestId: "node", Count: 1, Method: "GET"}},
+		{"empty", Entry{}},
+		{"negative count", Entry{RequestId: "node", Count: -12, Method: "GET"}},
+		{"every field", Entry{
+			RequestId: "node", Count: 12345, Method: "eth_call", Body: long, Bucket: "2026-01-02T03:04:00Z",
+			Pattern: "rpc", ReadCount: 1234, WriteCount: 11111, Type: "websocket", Tenant: long, ClientIP: "10.0.0.1",
+			Timestamp: "2026-01-02T03:04:05Z", Path: long,
+		}},
+		{"escaped body", Entry{RequestId: "node", Count: 1, Method: "POST",
+			Body: `{"jsonrpc":"2.0","params":["<script>&amp;</script>","a\\b"]}` + "\n\t\r\x00\x1f"}},
+		{"unicode path", Entry{RequestId: "nœud", Count: 1, Method: "GET", Path: "/ü/€/😀/\u2028\u2029/\ufffd"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := json.Marshal(test.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the entry separator
+			if size, want := entrySize(test.entry), len(encoded)+1; size != want {
+				t.Errorf("entrySize = %d, want %d for %s", size, want, encoded)
+			}
+		})
+	}
+}
+
+func TestEntrySizeOfInvalidUTF8(t *testing.T) {
+	entry := Entry{RequestId: "node", Count: 1, Method: "GET", Path: "/\xff\xfe/\xe2\x82"}
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the replacement character is written as is or escaped depending on the go version
+	if size := entrySize(entry); size < len(encoded)+1 || size > len(encoded)+1+4*3 {
+		t.Errorf("entrySize = %d, want between %d and %d", size, len(encoded)+1, len(encoded)+1+4*3)
+	}
+}
+
+func TestMaxBatchBytesFlushesEarly(t *testing.T) {
+	c := newCollector(t)
+	entry := Entry{RequestId: "node", Count: 1, Method: "GET"}
+	a := newTestActivity(t, &Config{
+		RemoteAddress: c.URL, FlushInterval: 60, BatchSize: 1000, MaxBatchBytes: 10 * entrySize(entry),
+	}, nil)
+
+	for i := 0; i < 9; i++ {
+		serve(a, "GET", "/node", "")
+	}
+	waitFor(t, time.Second, func() bool { return a.Stats().Enqueued == 9 && a.Stats().ChannelLen == 0 })
+	if calls := len(c.calls()); calls != 0 {
+		t.Fatalf("%d calls below MaxBatchBytes, want none", calls)
+	}
+	serve(a, "GET", "/node", "")
+	waitFor(t, time.Second, func() bool { return c.count("node") == 10 })
+}
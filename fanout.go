@@ -0,0 +1,66 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// endpoint is a remote address the batches are flushed to along with its flush counters
+type endpoint struct {
+	address string
+	flushed atomic.Uint64
+	failed  atomic.Uint64
+	breaker *circuitBreaker // nil unless BreakerThreshold is set
+}
+
+// EndpointStats is a snapshot of the flush counters of a remote address
+type EndpointStats struct {
+	Address       string `json:"address"`
+	Flushes       uint64 `json:"flushes"`        // flushes accepted by the remote address
+	FailedFlushes uint64 `json:"failed_flushes"` // flushes that failed after all their retries
+	Breaker       string `json:"breaker"`        // state of the circuit breaker: closed, open or half-open
+}
+
+// mirror sends a copy of the payload to the mirror endpoints in the worker pool without waiting for them, a failing
+// mirror is counted and logged but the batch isn't kept pending for it. the flush calling it may hold a slot of the
+// worker pool so the mirror sends never wait for a slot, the flush sends to the mirror itself while the pool is full
+func (a *Activity) mirror(payload []byte, contentType, idempotencyKey string) {
+	if len(a.mirrors) == 0 {
+		return
+	}
+	// the payload buffer goes back to the pool once the primary flush returns
+	payload = append([]byte(nil), payload...)
+	for _, mirror := range a.mirrors {
+		mirror := mirror
+		a.mirrorsWG.Add(1)
+		send := func() {
+			defer a.mirrorsWG.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					a.log().Error("FLUSH_LOGS", "remote_address", mirror.address, "error", fmt.Sprintf("mirror panicked: %v", r))
+				}
+			}()
+			if _, err := a.sendTo(a.ctx, mirror, payload, contentType, idempotencyKey); err != nil {
+				a.log().Error("FLUSH_LOGS", "remote_address", mirror.address, "status", statusCode(err), "error", err)
+			}
+		}
+		if !a.workers.TryGo(send) {
+			send()
+		}
+	}
+}
+
+// endpointStats returns a snapshot of the flush counters of the primary and mirror endpoints
+func (a *Activity) endpointStats() []EndpointStats {
+	endpoints := append([]*endpoint{a.primary}, a.mirrors...)
+	stats := make([]EndpointStats, 0, len(endpoints))
+	for _, e := range endpoints {
+		stats = append(stats, EndpointStats{
+			Address:       e.address,
+			Flushes:       e.flushed.Load(),
+			FailedFlushes: e.failed.Load(),
+			Breaker:       e.breaker.current(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package crossover_activity
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMirrorWithSingleWorker(t *testing.T) {
+	primary, mirror := newCollector(t), newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress:       primary.URL,
+		RemoteAddresses:     []string{mirror.URL},
+		BatchSize:           1,
+		MaxWorkerGoroutines: 1,
+	}, nil)
+
+	serve(a, "GET", "/node", "")
+	waitFor(t, 5*time.Second, func() bool { return primary.count("node") == 1 && mirror.count("node") == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestMirrorPendingBatchesOnce(t *testing.T) {
+	primary, mirror := newCollector(t), newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress:     primary.URL,
+		RemoteAddresses:   []string{mirror.URL},
+		FlushInterval:     60,
+		MaxPendingBatches: 10,
+	}, nil)
+
+	primary.setStatus(http.StatusInternalServerError)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	waitFor(t, 5*time.Second, func() bool { return mirror.count("node") == 1 })
+
+	primary.setStatus(http.StatusOK)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	waitFor(t, 5*time.Second, func() bool { return primary.count("node") == 2 })
+	a.mirrorsWG.Wait()
+	if count := mirror.count("node"); count != 2 {
+		t.Fatalf("mirror count = %d, want 2", count)
+	}
+}
@@ -0,0 +1,34 @@
+package crossover_activity
+
+// Flush flushes the entries buffered in the channels, the current batches and the pending batches
+// right away and returns once the flush completes, flush errors are reported like timed flushes.
+// flushes already handed to the workers or the pipeline aren't waited for. it returns right away once closed
+func (a *Activity) Flush() {
+	flushed := make(chan struct{})
+	select {
+	case a.flushRequests <- flushed:
+		<-flushed
+	case <-a.stopped:
+	}
+}
+
+// flushBuffered moves the entries buffered in the channels when it's called to the batch,
+// entries enqueued meanwhile are left for the next flush, then flushes the batch in the calling goroutine
+func (a *Activity) flushBuffered() {
+	for n := len(a.priorityChannel) + len(a.logsChannel); n > 0; n-- {
+		select {
+		case logEntry := <-a.priorityChannel:
+			a.addEntry(logEntry)
+		case logEntry := <-a.logsChannel:
+			a.addEntry(logEntry)
+		default:
+			n = 1
+		}
+	}
+	a.drainLimiter()
+	a.flushSketch()
+
+	batch := append(a.batch, a.takeRouteBatches()...)
+	a.resetBatch()
+	a.flushNow(batch)
+}
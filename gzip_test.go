@@ -0,0 +1,105 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipCompressedBatches(t *testing.T) {
+	flush := func(compression string) ([]byte, string) {
+		remote := newRawRemote(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, Compression: compression}, nil)
+		serve(a, "GET", "/mainnet", "")
+		serve(a, "POST", "/goerli", `[{"id":1},{"id":2}]`)
+		a.Flush()
+		body, header := remote.last()
+		return body, header.Get("Content-Encoding")
+	}
+
+	plain, encoding := flush("")
+	if len(encoding) != 0 || len(plain) == 0 {
+		t.Fatalf("encoding = %q, body = %q, want an uncompressed batch", encoding, plain)
+	}
+	compressed, encoding := flush(CompressionGzip)
+	if encoding != "gzip" {
+		t.Fatalf("encoding = %q, want gzip", encoding)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, plain) {
+		t.Fatalf("decompressed = %s, want %s", decompressed, plain)
+	}
+}
+
+func TestCompressionMustBeGzip(t *testing.T) {
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", Compression: "br"}); err == nil {
+		t.Fatal("want an error for Compression br")
+	}
+}
+
+// gzipped compresses the body
+func gzipped(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzipRequestBodies(t *testing.T) {
+	remote := newCollector(t)
+	var forwarded []byte
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		forwarded, _ = io.ReadAll(req.Body)
+	})
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, MaxBodySize: 1024}, next)
+	post := func(path string, body []byte) {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	batch := gzipped(t, `[{"jsonrpc":"2.0","id":1},{"jsonrpc":"2.0","id":2},{"jsonrpc":"2.0","id":3}]`)
+	post("/batch", batch)
+	if !bytes.Equal(forwarded, batch) {
+		t.Errorf("next read %q, want the compressed body unaltered", forwarded)
+	}
+	// a small body decompressing far beyond MaxBodySize is truncated rather than decompressed whole
+	bomb := gzipped(t, "["+strings.Repeat(`{"jsonrpc":"2.0","id":1},`, 1<<12)+`{"id":2}]`)
+	if len(bomb) >= 1024 {
+		t.Fatalf("bomb is %d bytes compressed, want it within MaxBodySize", len(bomb))
+	}
+	post("/bomb", bomb)
+	post("/corrupt", []byte("not gzip"))
+	a.Flush()
+
+	for id, want := range map[string]int{"batch": 3, "bomb": 0, "corrupt": 0} {
+		if count := remote.count(id); count != want {
+			t.Errorf("%s count = %d, want %d", id, count, want)
+		}
+	}
+	stats := a.Stats()
+	if stats.Truncated != 1 {
+		t.Errorf("truncated = %d, want the bomb only", stats.Truncated)
+	}
+	if stats.ParseFailures != 2 {
+		t.Errorf("parse failures = %d, want the bomb and the corrupt body", stats.ParseFailures)
+	}
+}
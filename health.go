@@ -0,0 +1,41 @@
+package crossover_activity
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// health is the state reported by HealthHandler
+type health struct {
+	Healthy       bool       `json:"healthy"`
+	LastFlushOK   bool       `json:"last_flush_ok"`             // true until a flush fails
+	LastFlushTime *time.Time `json:"last_flush_time,omitempty"` // time of the last successful flush
+	ChannelDepth  int        `json:"channel_depth"`
+	ChannelCap    int        `json:"channel_cap"`
+}
+
+// HealthHandler reports whether the last flush to the remote address succeeded, the time of the
+// last successful flush and the channel depth as JSON, with 503 once the last flush failed,
+// to be wired to a route monitored by the operator
+func (a *Activity) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		logs := a.logs()
+		h := health{
+			LastFlushOK:  !a.stats.lastFlushFailed.Load(),
+			ChannelDepth: len(logs),
+			ChannelCap:   cap(logs),
+		}
+		h.Healthy = h.LastFlushOK
+		if nanos := a.stats.lastFlushTime.Load(); nanos != 0 {
+			lastFlush := time.Unix(0, nanos).UTC()
+			h.LastFlushTime = &lastFlush
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		if !h.Healthy {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(h)
+	})
+}
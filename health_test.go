@@ -0,0 +1,49 @@
+package crossover_activity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, BufferSize: 50}, nil)
+	check := func() (int, health) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		a.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+		var h health
+		if err := json.Unmarshal(recorder.Body.Bytes(), &h); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, h
+	}
+
+	status, h := check()
+	if status != http.StatusOK || !h.Healthy || h.LastFlushTime != nil || h.ChannelCap != 50 {
+		t.Fatalf("status = %d, health = %+v, want healthy before any flush", status, h)
+	}
+
+	remote.setStatus(http.StatusInternalServerError)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	status, h = check()
+	if status != http.StatusServiceUnavailable || h.Healthy || h.LastFlushOK || h.LastFlushTime != nil {
+		t.Fatalf("status = %d, health = %+v, want unhealthy after the failed flush", status, h)
+	}
+
+	remote.setStatus(http.StatusOK)
+	before := time.Now().Add(-time.Second)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	status, h = check()
+	if status != http.StatusOK || !h.Healthy || !h.LastFlushOK {
+		t.Fatalf("status = %d, health = %+v, want healthy after the successful flush", status, h)
+	}
+	if h.LastFlushTime == nil || h.LastFlushTime.Before(before) {
+		t.Fatalf("last flush time = %v, want the time of the successful flush", h.LastFlushTime)
+	}
+}
@@ -0,0 +1,234 @@
+package crossover_activity
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is a remote address recording the batches flushed to it, it responds with status
+type collector struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	status  int
+	batches [][]Entry
+	keys    []string // idempotency key of every call
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{status: http.StatusOK}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var batch []Entry
+		_ = json.Unmarshal(body, &batch)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.keys = append(c.keys, req.Header.Get(IdempotencyKeyHeader))
+		if c.status != http.StatusOK {
+			rw.WriteHeader(c.status)
+			return
+		}
+		c.batches = append(c.batches, batch)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// setStatus sets the status the collector responds with, batches aren't recorded unless it's 200
+func (c *collector) setStatus(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// count returns the count flushed for the request id
+func (c *collector) count(requestId string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, batch := range c.batches {
+		for _, entry := range batch {
+			if entry.RequestId == requestId {
+				count += entry.Count
+			}
+		}
+	}
+	return count
+}
+
+// entries returns the entries of the batches flushed so far
+func (c *collector) entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entries []Entry
+	for _, batch := range c.batches {
+		entries = append(entries, batch...)
+	}
+	return entries
+}
+
+// calls returns the idempotency keys of the calls received so far
+func (c *collector) calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.keys...)
+}
+
+// rawRemote is a remote address keeping the method, the header and the body of the last call
+type rawRemote struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	method string
+	body   []byte
+	header http.Header
+}
+
+func newRawRemote(t *testing.T) *rawRemote {
+	r := &rawRemote{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.method, r.body, r.header = req.Method, body, req.Header.Clone()
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// last returns the body and the header of the last call
+func (r *rawRemote) last() ([]byte, http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body, r.header
+}
+
+// lastMethod returns the method of the last call
+func (r *rawRemote) lastMethod() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.method
+}
+
+// stalledRemote is a remote address holding its first call until it's released, the batch processor flushing
+// it can't drain the channels meanwhile. it counts the flushed entries per request id
+type stalledRemote struct {
+	*httptest.Server
+
+	received chan struct{}
+	release  chan struct{}
+	mu       sync.Mutex
+	counts   map[string]int
+}
+
+func newStalledRemote(t *testing.T) *stalledRemote {
+	r := &stalledRemote{received: make(chan struct{}, 1), release: make(chan struct{}), counts: map[string]int{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case r.received <- struct{}{}:
+			<-r.release
+		default:
+		}
+		body, _ := io.ReadAll(req.Body)
+		var batch []Entry
+		_ = json.Unmarshal(body, &batch)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, entry := range batch {
+			r.counts[entry.RequestId] += entry.Count
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// stall makes the batch processor of the Activity flush a request to the remote address and returns once the
+// call is held. the returned function releases the call and waits for the flush
+func (r *stalledRemote) stall(a *Activity) func() {
+	serve(a, "GET", "/first", "")
+	flushed := make(chan struct{})
+	go func() {
+		a.Flush()
+		close(flushed)
+	}()
+	<-r.received
+	return func() {
+		close(r.release)
+		<-flushed
+	}
+}
+
+// count returns the count flushed for the request id
+func (r *stalledRemote) count(requestId string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[requestId]
+}
+
+// newTestActivity creates an Activity with the config, APIKey and Pattern default to a test key and
+// a pattern matching the first path segment. it's closed once the test ends
+func newTestActivity(t *testing.T, config *Config, next http.Handler) *Activity {
+	t.Helper()
+	if len(config.APIKey) == 0 {
+		config.APIKey = "test"
+	}
+	if len(config.Pattern) == 0 {
+		config.Pattern = "^/([^/]+)"
+	}
+	if next == nil {
+		next = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	}
+	handler, err := New(context.Background(), next, config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := handler.(*Activity)
+	t.Cleanup(func() { _ = a.Close(context.Background()) })
+	return a
+}
+
+// serve serves a request of the method to the path with the body through the Activity
+func serve(a *Activity, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(body) != 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// waitFor waits for the condition to hold, failing the test once the timeout is over
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %s", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// configError returns the error New returns for the config, APIKey and Pattern default as in newTestActivity
+func configError(config *Config) error {
+	if len(config.APIKey) == 0 {
+		config.APIKey = "test"
+	}
+	if len(config.Pattern) == 0 {
+		config.Pattern = "^/([^/]+)"
+	}
+	handler, err := New(context.Background(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), config, "test")
+	if err == nil {
+		_ = handler.(*Activity).Close(context.Background())
+	}
+	return err
+}
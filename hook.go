@@ -0,0 +1,57 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// flushHook wraps the OnFlush hook so it can be stored in an atomic.Value
+type flushHook struct {
+	fn func(batch []Entry, status int)
+}
+
+// SetOnFlush calls fn after every flush with the flushed batch and the status code the remote address
+// responded with, 0 if it didn't respond. fn runs in the flushing goroutine without any lock held,
+// it must not modify the batch. a panicking fn is logged and doesn't fail the flush. a nil fn removes the hook
+func (a *Activity) SetOnFlush(fn func(batch []Entry, status int)) {
+	a.onFlush.Store(flushHook{fn: fn})
+}
+
+// notifyFlush calls the OnFlush hook with the outcome of the flush of the batch
+func (a *Activity) notifyFlush(batch []Entry, err error) {
+	hook, _ := a.onFlush.Load().(flushHook)
+	if hook.fn == nil {
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = statusCode(err)
+	}
+	// the batch is already flushed or kept pending, a panicking hook is logged without failing the flush
+	defer func() {
+		if r := recover(); r != nil {
+			a.log().Error("ON_FLUSH", "status", status, "error", fmt.Sprintf("hook panicked: %v", r))
+		}
+	}()
+	hook.fn(batch, status)
+}
+
+// idTransform wraps the TransformID hook so it can be stored in an atomic.Value
+type idTransform struct {
+	fn func(requestId string) string
+}
+
+// SetTransformID reshapes every request id matched by the patterns with fn, e.g. to lowercase or hash it,
+// before the entry is built. fn runs in the request goroutine. a nil fn removes the transform
+func (a *Activity) SetTransformID(fn func(requestId string) string) {
+	a.transformID.Store(idTransform{fn: fn})
+}
+
+// transformRequestId applies the TransformID hook to the request id
+func (a *Activity) transformRequestId(requestId string) string {
+	transform, _ := a.transformID.Load().(idTransform)
+	if transform.fn == nil {
+		return requestId
+	}
+	return transform.fn(requestId)
+}
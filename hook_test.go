@@ -0,0 +1,65 @@
+package crossover_activity_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	crossover_activity "github.com/kotalco/crossover-activity"
+	"github.com/kotalco/crossover-activity/activitytest"
+)
+
+func TestOnFlushOutsideThePackage(t *testing.T) {
+	h, err := activitytest.New(&crossover_activity.Config{Pattern: "^/([^/]+)", FlushInterval: 60}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	var mu sync.Mutex
+	var flushed []crossover_activity.Entry
+	var statuses []int
+	h.Activity.SetOnFlush(func(batch []crossover_activity.Entry, status int) {
+		mu.Lock()
+		defer mu.Unlock()
+		flushed = append(flushed, batch...)
+		statuses = append(statuses, status)
+	})
+
+	h.Serve(httptest.NewRequest("GET", "/node", nil))
+	h.Flush()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(flushed) != 1 || flushed[0].RequestId != "node" || flushed[0].Count != 1 || statuses[0] != 200 {
+		t.Fatalf("flushed = %+v with statuses %v, want the node entry with 200", flushed, statuses)
+	}
+}
+
+func TestTransformIDOutsideThePackage(t *testing.T) {
+	h, err := activitytest.New(&crossover_activity.Config{Pattern: "^/([^/]+)", FlushInterval: 60}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	hash := func(requestId string) string {
+		sum := sha256.Sum256([]byte(requestId))
+		return hex.EncodeToString(sum[:8])
+	}
+	h.Serve(httptest.NewRequest("GET", "/plain", nil))
+	h.Activity.SetTransformID(hash)
+	h.Serve(httptest.NewRequest("GET", "/secret-key", nil))
+	h.Serve(httptest.NewRequest("GET", "/secret-key", nil))
+	h.Activity.SetTransformID(nil)
+	h.Serve(httptest.NewRequest("GET", "/plain", nil))
+
+	counts := map[string]int{}
+	for _, entry := range h.Flush() {
+		counts[entry.RequestId] += entry.Count
+	}
+	if counts["plain"] != 2 || counts[hash("secret-key")] != 2 || len(counts) != 2 {
+		t.Fatalf("counts = %v, want plain 2 and the hashed id 2", counts)
+	}
+}
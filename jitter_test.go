@@ -0,0 +1,36 @@
+package crossover_activity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlushJitter(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", FlushInterval: 10, FlushJitter: 0.2}, nil)
+	low, high := 8*time.Second, 12*time.Second
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := a.flushDelay(10)
+		if delay < low || delay > high {
+			t.Fatalf("delay = %s, want between %s and %s", delay, low, high)
+		}
+		distinct[delay] = true
+	}
+	if len(distinct) < 2 {
+		t.Fatalf("delays = %v, want randomized delays", distinct)
+	}
+}
+
+func TestNoFlushJitter(t *testing.T) {
+	a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", FlushInterval: 10}, nil)
+	for i := 0; i < 10; i++ {
+		if delay := a.flushDelay(10); delay != 10*time.Second {
+			t.Fatalf("delay = %s, want exactly the flush interval", delay)
+		}
+	}
+	for _, jitter := range []float64{-0.1, 1.1} {
+		if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", FlushJitter: jitter}); err == nil {
+			t.Errorf("FlushJitter %v: want an error", jitter)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath a parsed CountJSONPath, the object keys and array indexes leading from the body to the counted array
+type jsonPath []jsonPathStep
+
+type jsonPathStep struct {
+	key   string
+	index int // used when key is empty
+}
+
+// parseJSONPath parses the dotted paths with array indexes, with or without the leading $, e.g. $.requests,
+// data.batch or $.batches[0].calls
+func parseJSONPath(path string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("path %q is empty", path)
+	}
+	var steps jsonPath
+	for len(rest) != 0 {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("path %q has an unclosed [", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q has an invalid index %q", path, rest[1:end])
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			continue
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end == -1 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("path %q has an empty key", path)
+		}
+		steps = append(steps, jsonPathStep{key: rest[:end]})
+		rest = rest[end:]
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("path %q ends with a .", path)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// array returns the array at the path in the JSON body, false if the body can't be decoded
+// or the path doesn't lead to an array
+func (p jsonPath) array(body []byte) ([]interface{}, bool) {
+	var value interface{}
+	if json.NewDecoder(bytes.NewReader(body)).Decode(&value) != nil {
+		return nil, false
+	}
+	for _, step := range p {
+		if len(step.key) != 0 {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		array, ok := value.([]interface{})
+		if !ok || step.index >= len(array) {
+			return nil, false
+		}
+		value = array[step.index]
+	}
+	array, ok := value.([]interface{})
+	return array, ok
+}
@@ -0,0 +1,41 @@
+package crossover_activity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountJSONPath(t *testing.T) {
+	for _, test := range []struct {
+		name, path, body string
+		count            int
+	}{
+		{"top level key", "$.requests", `{"requests":[{"id":1},{"id":2},{"id":3}]}`, 3},
+		{"without $", "requests", `{"requests":[{"id":1},{"id":2}]}`, 2},
+		{"nested key", "$.data.batch", `{"data":{"batch":[{"id":1},{"id":2}]}}`, 2},
+		{"indexed array", "$.batches[0].calls", `{"batches":[{"calls":[{"id":1},{"id":2}]},{"calls":[]}]}`, 2},
+		{"second index", "$.batches[1].calls", `{"batches":[{"calls":[]},{"calls":[{"id":1},{"id":2},{"id":3},{"id":4}]}]}`, 4},
+		{"empty array", "$.requests", `{"requests":[]}`, 0},
+		// bodies without an array at the path are counted like the bodies without CountJSONPath
+		{"missing key falls back to the object", "$.requests", `{"calls":[{"id":1},{"id":2}]}`, 1},
+		{"missing index falls back to the object", "$.batches[2].calls", `{"batches":[{"calls":[{"id":1}]}]}`, 1},
+		{"not an array falls back to the object", "$.requests", `{"requests":{"id":1}}`, 1},
+		{"top level array is kept", "$.requests", `[{"id":1},{"id":2}]`, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestActivity(t, &Config{RemoteAddress: "http://127.0.0.1:1", CountJSONPath: test.path}, nil)
+			if count := a.requestCount([]byte(test.body), jsonType); count != test.count {
+				t.Errorf("count = %d, want %d", count, test.count)
+			}
+		})
+	}
+}
+
+func TestInvalidCountJSONPath(t *testing.T) {
+	for _, path := range []string{"$", "$.", "$.requests[", "$.requests[-1]", "$.requests[a]", "$..requests", "$.requests."} {
+		err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", CountJSONPath: path})
+		if err == nil || !strings.Contains(err.Error(), "CountJSONPath") {
+			t.Errorf("CountJSONPath %q error = %v, want an invalid CountJSONPath", path, err)
+		}
+	}
+}
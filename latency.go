@@ -0,0 +1,59 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets upper bounds, in seconds, of the flush latency histogram buckets, those of the Prometheus clients
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// latencyHistogram counts the flush calls by duration, the counts are per bucket and summed up when written
+type latencyHistogram struct {
+	buckets [12]atomic.Uint64 // a count per latencyBuckets and the last one for the calls above every bucket
+	sum     atomic.Int64      // nanoseconds
+}
+
+// observe records a call of the given duration
+func (h *latencyHistogram) observe(elapsed time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && elapsed.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	h.buckets[i].Add(1)
+	h.sum.Add(int64(elapsed))
+}
+
+// write writes the histogram in the Prometheus text exposition format
+func (h *latencyHistogram) write(w io.Writer, name, help, instance string) {
+	fmt.Fprintf(w, "# HELP crossover_activity_%s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE crossover_activity_%s histogram\n", name)
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += h.buckets[i].Load()
+		fmt.Fprintf(w, "crossover_activity_%s_bucket{name=%q,le=\"%g\"} %d\n", name, instance, bound, cumulative)
+	}
+	// +Inf counts every call
+	cumulative += h.buckets[len(latencyBuckets)].Load()
+	fmt.Fprintf(w, "crossover_activity_%s_bucket{name=%q,le=\"+Inf\"} %d\n", name, instance, cumulative)
+	fmt.Fprintf(w, "crossover_activity_%s_sum{name=%q} %g\n", name, instance, time.Duration(h.sum.Load()).Seconds())
+	fmt.Fprintf(w, "crossover_activity_%s_count{name=%q} %d\n", name, instance, cumulative)
+}
+
+// observeFlush records the duration of a flush call to the address and logs calls slower than slowFlush
+func (a *Activity) observeFlush(address string, elapsed time.Duration) {
+	a.flushLatency.observe(elapsed)
+	if a.slowFlush > 0 && elapsed > a.slowFlush {
+		a.log().Warn("SLOW_FLUSH", "remote_address", address, "elapsed", elapsed)
+	}
+}
+
+// reset zeroes the histogram
+func (h *latencyHistogram) reset() {
+	for i := range h.buckets {
+		h.buckets[i].Store(0)
+	}
+	h.sum.Store(0)
+}
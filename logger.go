@@ -0,0 +1,73 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger receives the diagnostics of the plugin, msg names the event (e.g. FLUSH_LOGS) and
+// keyvals are alternating keys and values such as request_id, entries, status and error
+type Logger interface {
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// loggerValue wraps the logger so loggers of different types can be stored in the same atomic.Value
+type loggerValue struct {
+	Logger
+}
+
+// stdLogger writes the diagnostics with the standard log package as the level, the event and key=value pairs
+type stdLogger struct{}
+
+func (stdLogger) Info(msg string, keyvals ...interface{}) {
+	log.Print(formatEntry("INFO", msg, keyvals))
+}
+
+func (stdLogger) Warn(msg string, keyvals ...interface{}) {
+	log.Print(formatEntry("WARNING", msg, keyvals))
+}
+
+func (stdLogger) Error(msg string, keyvals ...interface{}) {
+	log.Print(formatEntry("ERROR", msg, keyvals))
+}
+
+// formatEntry formats the entry as "LEVEL MSG: key=value ...", values containing spaces are quoted
+func formatEntry(level string, msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+	b.WriteString(":")
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		text := fmt.Sprint(value)
+		if strings.ContainsAny(text, " \t\n\"=") {
+			text = fmt.Sprintf("%q", text)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], text)
+	}
+	return b.String()
+}
+
+// SetLogger sends the diagnostics of the plugin to the logger instead of the standard log package,
+// a nil logger restores the default one
+func (a *Activity) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = stdLogger{}
+	}
+	a.logger.Store(loggerValue{logger})
+}
+
+// log returns the current logger
+func (a *Activity) log() Logger {
+	return a.logger.Load().(loggerValue).Logger
+}
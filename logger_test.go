@@ -0,0 +1,83 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// logRecord is a diagnostic received by the capturing logger with its keyvals as a map
+type logRecord struct {
+	level, msg string
+	fields     map[string]interface{}
+}
+
+// capturingLogger records every diagnostic of the plugin
+type capturingLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *capturingLogger) add(level, msg string, keyvals []interface{}) {
+	fields := map[string]interface{}{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[keyvals[i].(string)] = keyvals[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, logRecord{level, msg, fields})
+}
+
+func (l *capturingLogger) Info(msg string, keyvals ...interface{})  { l.add("INFO", msg, keyvals) }
+func (l *capturingLogger) Warn(msg string, keyvals ...interface{})  { l.add("WARNING", msg, keyvals) }
+func (l *capturingLogger) Error(msg string, keyvals ...interface{}) { l.add("ERROR", msg, keyvals) }
+
+// find returns the records of the level and msg
+func (l *capturingLogger) find(level, msg string) []logRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logRecord
+	for _, record := range l.records {
+		if record.level == level && record.msg == msg {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+func TestLoggerFieldsOfFailedFlush(t *testing.T) {
+	remote := newCollector(t)
+	remote.setStatus(http.StatusBadGateway)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	logger := &capturingLogger{}
+	a.SetLogger(logger)
+
+	serve(a, "GET", "/a", "")
+	serve(a, "GET", "/b", "")
+	a.Flush()
+
+	records := logger.find("ERROR", "FLUSH_LOGS")
+	if len(records) != 1 {
+		t.Fatalf("records = %+v, want a single FLUSH_LOGS error", logger.records)
+	}
+	fields := records[0].fields
+	if fields["entries"] != 2 || fields["status"] != http.StatusBadGateway || fields["error"] == nil {
+		t.Fatalf("fields = %v, want entries 2, status 502 and the error", fields)
+	}
+}
+
+func TestFormatEntry(t *testing.T) {
+	for _, test := range []struct {
+		keyvals []interface{}
+		want    string
+	}{
+		{nil, "WARNING DROPPED:"},
+		{[]interface{}{"request_id", "node", "entries", 3}, "WARNING DROPPED: request_id=node entries=3"},
+		{[]interface{}{"error", "connection refused"}, `WARNING DROPPED: error="connection refused"`},
+		{[]interface{}{"request_id"}, "WARNING DROPPED: request_id=MISSING"},
+	} {
+		if entry := formatEntry("WARNING", "DROPPED", test.keyvals); entry != test.want {
+			t.Errorf("entry = %q, want %q", entry, test.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MetricsHandler serves the plugin counters in the Prometheus text exposition format,
+// labeled with the middleware name, to be scraped from a route wired by the operator
+func (a *Activity) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		a.writeMetrics(rw)
+	})
+}
+
+// writeMetrics writes the plugin counters in the Prometheus text exposition format
+func (a *Activity) writeMetrics(w io.Writer) {
+	stats := a.Stats()
+	metric := func(name, kind, help string, value uint64) {
+		fmt.Fprintf(w, "# HELP crossover_activity_%s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE crossover_activity_%s %s\n", name, kind)
+		fmt.Fprintf(w, "crossover_activity_%s{name=%q} %d\n", name, a.name, value)
+	}
+
+	metric("enqueued_entries_total", "counter", "Entries sent to the buffer channels.", stats.Enqueued)
+	metric("dropped_entries_total", "counter", "Entries dropped because the buffer channel was full.", stats.Dropped)
+	metric("flushed_batches_total", "counter", "Batches accepted by the remote address.", stats.FlushedBatches)
+	metric("flushed_entries_total", "counter", "Entries of the batches accepted by the remote address.", stats.FlushedEntries)
+	metric("failed_flushes_total", "counter", "Flushes that failed after all their retries.", stats.FailedFlushes)
+	metric("parse_failures_total", "counter", "Request bodies that couldn't be parsed for counting.", stats.ParseFailures)
+	metric("method_clamps_total", "counter", "Request methods capped by MethodMaxCount.", stats.MethodClamps)
+	metric("overflowed_entries_total", "counter", "Entries appended to the overflow file because the channel was full.", stats.Overflowed)
+	metric("rate_limited_entries_total", "counter", "Entries held by EnqueueRate, their counts are enqueued later.", stats.RateLimited)
+	metric("rejected_entries_total", "counter", "Entries the remote address reported as rejected.", stats.Rejected)
+	metric("dry_run_batches_total", "counter", "Batches logged instead of flushed by DryRun.", stats.DryRunBatches)
+	metric("dry_run_entries_total", "counter", "Entries of the batches logged instead of flushed by DryRun.", stats.DryRunEntries)
+	metric("unmatched_requests_total", "counter", "Requests not matching any pattern, which aren't recorded.", stats.Unmatched)
+	metric("truncated_bodies_total", "counter", "Request bodies beyond MaxBodySize, counted from their first MaxBodySize bytes.", stats.Truncated)
+	metric("slow_matches_total", "counter", "Paths the patterns took longer than SlowMatchThreshold to match.", stats.SlowMatches)
+	metric("rejected_requests_total", "counter", "Requests rejected with 503 by RejectWhenFull because the buffer channel was full.", stats.RejectedRequests)
+	metric("deduplicated_requests_total", "counter", "Requests not recorded again because of their DedupHeader.", stats.Deduplicated)
+	metric("channel_depth", "gauge", "Entries waiting in the buffer channel.", uint64(len(a.logs())))
+	a.flushLatency.write(w, "flush_latency_seconds", "Duration of the flush calls to the remote addresses, up to their response headers.", a.name)
+
+	endpointMetric := func(name, help string, value func(EndpointStats) uint64) {
+		fmt.Fprintf(w, "# HELP crossover_activity_%s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE crossover_activity_%s counter\n", name)
+		for _, e := range stats.Endpoints {
+			fmt.Fprintf(w, "crossover_activity_%s{name=%q,remote_address=%q} %d\n", name, a.name, e.Address, value(e))
+		}
+	}
+	endpointMetric("endpoint_flushes_total", "Flushes accepted by the remote address.",
+		func(e EndpointStats) uint64 { return e.Flushes })
+	endpointMetric("endpoint_failed_flushes_total", "Flushes to the remote address that failed after all their retries.",
+		func(e EndpointStats) uint64 { return e.FailedFlushes })
+
+	fmt.Fprintf(w, "# HELP crossover_activity_endpoint_breaker_state Circuit breaker state of the remote address, 1 for the current state.\n")
+	fmt.Fprintf(w, "# TYPE crossover_activity_endpoint_breaker_state gauge\n")
+	for _, e := range stats.Endpoints {
+		for _, state := range []string{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+			value := 0
+			if e.Breaker == state {
+				value = 1
+			}
+			fmt.Fprintf(w, "crossover_activity_endpoint_breaker_state{name=%q,remote_address=%q,state=%q} %d\n", a.name, e.Address, state, value)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+
+	remote.setStatus(http.StatusInternalServerError)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	remote.setStatus(http.StatusOK)
+	serve(a, "GET", "/node", "")
+	serve(a, "GET", "/other", "")
+	a.Flush()
+
+	recorder := httptest.NewRecorder()
+	a.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %q, want the Prometheus text format", contentType)
+	}
+	metrics := recorder.Body.String()
+	for _, line := range []string{
+		`# TYPE crossover_activity_dropped_entries_total counter`,
+		`crossover_activity_enqueued_entries_total{name="test"} 3`,
+		`crossover_activity_dropped_entries_total{name="test"} 0`,
+		`crossover_activity_flushed_batches_total{name="test"} 1`,
+		`crossover_activity_flushed_entries_total{name="test"} 2`,
+		`crossover_activity_failed_flushes_total{name="test"} 1`,
+		`# TYPE crossover_activity_channel_depth gauge`,
+		`crossover_activity_channel_depth{name="test"} 0`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("metrics don't contain %q:\n%s", line, metrics)
+		}
+	}
+}
+
+func TestFlushLatency(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	remote := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(delay)
+	}))
+	t.Cleanup(remote.Close)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, SlowFlushThreshold: 50}, nil)
+	logger := &capturingLogger{}
+	a.SetLogger(logger)
+
+	serve(a, "GET", "/node", "")
+	a.Flush()
+
+	if sum := time.Duration(a.flushLatency.sum.Load()); sum < delay {
+		t.Errorf("recorded latency = %v, want at least %v", sum, delay)
+	}
+	recorder := httptest.NewRecorder()
+	a.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := recorder.Body.String()
+	for _, line := range []string{
+		`# TYPE crossover_activity_flush_latency_seconds histogram`,
+		`crossover_activity_flush_latency_seconds_bucket{name="test",le="0.05"} 0`,
+		`crossover_activity_flush_latency_seconds_bucket{name="test",le="+Inf"} 1`,
+		`crossover_activity_flush_latency_seconds_count{name="test"} 1`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("metrics don't contain %q:\n%s", line, metrics)
+		}
+	}
+	slow := logger.find("WARNING", "SLOW_FLUSH")
+	if len(slow) != 1 {
+		t.Fatalf("slow flush logs = %d, want 1", len(slow))
+	}
+	if elapsed, _ := slow[0].fields["elapsed"].(time.Duration); elapsed < delay {
+		t.Errorf("logged elapsed = %v, want at least %v", elapsed, delay)
+	}
+}
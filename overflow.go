@@ -0,0 +1,174 @@
+package crossover_activity
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOverflowMaxBytes int64 = 64 * 1024 * 1024 // 64 MB of entries kept on disk while the channel is full
+	OverflowReplayInterval        = time.Second      // interval the overflowed entries are re-enqueued at
+)
+
+// overflowQueue append only file of the entries that didn't fit in the full channel, replayed from the
+// read offset once the channel drains. the file is truncated once it's fully replayed, entries left
+// on close are replayed by the next instance using the same file
+type overflowQueue struct {
+	mu     sync.Mutex
+	file   *os.File
+	offset int64 // offset of the first entry not replayed yet
+	size   int64
+	max    int64
+	resets int // incremented by reset so a replay in progress doesn't move the offset of the emptied file
+}
+
+func openOverflowQueue(path string, max int64) (*overflowQueue, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &overflowQueue{file: file, size: info.Size(), max: max}, nil
+}
+
+// write appends the entry and reports whether it was kept, entries beyond the max size aren't
+func (q *overflowQueue) write(logEntry Entry) bool {
+	line, err := json.Marshal(logEntry)
+	if err != nil {
+		return false
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size+int64(len(line)) > q.max {
+		return false
+	}
+	n, err := q.file.Write(line)
+	q.size += int64(n)
+	if err != nil && n != 0 {
+		// skip the partially written line on replay
+		q.size, _ = q.file.Seek(0, io.SeekEnd)
+	}
+	return err == nil
+}
+
+// replay sends the overflowed entries to the channel while it's less than half full, leaving
+// the rest of the channel to the live entries, and returns the number of unreadable entries skipped
+func (q *overflowQueue) replay(channel chan Entry) (skipped int, err error) {
+	q.mu.Lock()
+	offset, size, resets := q.offset, q.size, q.resets
+	q.mu.Unlock()
+	if offset == size {
+		return 0, nil
+	}
+
+	// appends only add bytes after size so the entries before it can be read without the lock
+	reader := bufio.NewReader(io.NewSectionReader(q.file, offset, size-offset))
+	for len(channel) < cap(channel)/2 {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			} else if len(line) != 0 {
+				// a partially written line at the end, skip it
+				offset += int64(len(line))
+				skipped++
+			}
+			break
+		}
+		var logEntry Entry
+		if json.Unmarshal(line, &logEntry) != nil {
+			offset += int64(len(line))
+			skipped++
+			continue
+		}
+		select {
+		case channel <- logEntry:
+			offset += int64(len(line))
+			continue
+		default:
+		}
+		break
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.resets != resets {
+		return skipped, err
+	}
+	q.offset = offset
+	if q.offset == q.size {
+		// everything was replayed, start over to bound the file size
+		if truncErr := q.file.Truncate(0); truncErr != nil && err == nil {
+			err = truncErr
+		}
+		q.offset, q.size = 0, 0
+	}
+	return skipped, err
+}
+
+// pending returns the number of bytes of entries waiting to be replayed
+func (q *overflowQueue) pending() int64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size - q.offset
+}
+
+// reset drops the entries waiting to be replayed and truncates the file, a nil overflow queue has nothing to drop
+func (q *overflowQueue) reset() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.resets++
+	q.offset, q.size = 0, 0
+	return q.file.Truncate(0)
+}
+
+// close closes the overflow file, a nil overflow queue has nothing to close
+func (q *overflowQueue) close() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
+
+// replayOverflow runs in a separate goroutine and re-enqueues the overflowed entries until the plugin is closing
+func (a *Activity) replayOverflow() {
+	defer close(a.overflowDone)
+	ticker := time.NewTicker(OverflowReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.logsMu.RLock()
+			skipped, err := a.overflow.replay(a.logsChannel)
+			a.logsMu.RUnlock()
+			if skipped > 0 {
+				a.stats.dropped.Add(uint64(skipped))
+				a.log().Warn("DROPPED", "entries", skipped, "reason", "unreadable overflow entries")
+			}
+			if err != nil {
+				a.log().Error("OVERFLOW", "error", err)
+				a.stats.setError(err)
+			}
+		case <-a.done:
+			return
+		}
+	}
+}
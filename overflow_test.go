@@ -0,0 +1,71 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOverflowPolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy     string
+		old, fresh int
+	}{
+		{"", 4, 0},
+		{OverflowDropNew, 4, 0},
+		{OverflowDropOld, 2, 2},
+	} {
+		remote := newStalledRemote(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, BufferSize: 4, OverflowPolicy: test.policy}, nil)
+
+		release := remote.stall(a)
+		for i := 0; i < 4; i++ {
+			serve(a, "GET", "/old", "")
+		}
+		serve(a, "GET", "/new", "")
+		serve(a, "GET", "/new", "")
+		release()
+		a.Flush()
+
+		if old, fresh := remote.count("old"), remote.count("new"); old != test.old || fresh != test.fresh {
+			t.Errorf("%q: counts = %d, %d, want old %d and new %d", test.policy, old, fresh, test.old, test.fresh)
+		}
+		if dropped := a.Stats().Dropped; dropped != 2 {
+			t.Errorf("%q: dropped = %d, want 2", test.policy, dropped)
+		}
+	}
+}
+
+func TestOverflowPolicyMustBeKnown(t *testing.T) {
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", OverflowPolicy: "drop-random"}); err == nil {
+		t.Fatal("want an error for OverflowPolicy drop-random")
+	}
+}
+
+func TestRejectWhenFull(t *testing.T) {
+	remote := newStalledRemote(t)
+	served := 0
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served++ })
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 30, BufferSize: 2, RejectWhenFull: true}, next)
+
+	release := remote.stall(a)
+	for i := 0; i < 2; i++ {
+		if status := serve(a, "GET", "/node", "").Code; status != http.StatusOK {
+			t.Fatalf("status = %d while the channel has room, want 200", status)
+		}
+	}
+	recorder := serve(a, "GET", "/node", "")
+	release()
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") != "30" {
+		t.Fatalf("status = %d, Retry-After = %q, want 503 retrying after the flush interval", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	if served != 3 {
+		t.Fatalf("served = %d, want the stalled and the 2 accepted requests only", served)
+	}
+	if rejected, dropped := a.Stats().RejectedRequests, a.Stats().Dropped; rejected != 1 || dropped != 0 {
+		t.Fatalf("rejected = %d, dropped = %d, want 1, 0", rejected, dropped)
+	}
+	a.Flush()
+	if count := remote.count("node"); count != 2 {
+		t.Fatalf("count = %d, want the 2 accepted requests", count)
+	}
+}
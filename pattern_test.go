@@ -0,0 +1,157 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNamedPatterns(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: remote.URL,
+		FlushInterval: 60,
+		Pattern:       "^/v1/([^/]+)",
+		Patterns: map[string]string{
+			"rest": "^/rest/([^/]+)",
+			"ws":   "^/ws/([^/]+)",
+		},
+	}, nil)
+	serve(a, "GET", "/v1/node", "")
+	serve(a, "GET", "/rest/node", "")
+	serve(a, "GET", "/rest/node", "")
+	serve(a, "GET", "/ws/node", "")
+	a.Flush()
+
+	counts := map[string]int{}
+	for _, entry := range remote.entries() {
+		if entry.RequestId != "node" {
+			t.Fatalf("entry = %+v, want request id node", entry)
+		}
+		counts[entry.Pattern] += entry.Count
+	}
+	if counts[""] != 1 || counts["rest"] != 2 || counts["ws"] != 1 || len(counts) != 3 {
+		t.Fatalf("counts = %v, want 1 without a name, rest 2 and ws 1", counts)
+	}
+}
+
+func TestPatternList(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: remote.URL,
+		FlushInterval: 60,
+		Pattern:       "^/v1/([^/]+)",
+		PatternList:   []string{"^/rpc/([^/]+)", "^/([^/]+)/ws"},
+	}, nil)
+	serve(a, "GET", "/v1/mainnet", "")
+	serve(a, "GET", "/rpc/goerli", "")
+	serve(a, "GET", "/sepolia/ws", "")
+	serve(a, "GET", "/unmatched", "")
+	a.Flush()
+
+	counts := map[string]int{}
+	for _, entry := range remote.entries() {
+		counts[entry.RequestId] += entry.Count
+	}
+	if counts["mainnet"] != 1 || counts["goerli"] != 1 || counts["sepolia"] != 1 || len(counts) != 3 {
+		t.Fatalf("counts = %v, want mainnet, goerli and sepolia once", counts)
+	}
+}
+
+func TestUnmatchedPathsAreNotRecorded(t *testing.T) {
+	remote := newCollector(t)
+	served := 0
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served++ })
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, Pattern: "^/v1/([^/]+)"}, next)
+	serve(a, "GET", "/health", "")
+	serve(a, "GET", "/", "")
+	a.Flush()
+	if served != 2 {
+		t.Fatalf("served = %d, want the unmatched requests passed through", served)
+	}
+	if stats := a.Stats(); stats.Enqueued != 0 || stats.Unmatched != 2 {
+		t.Fatalf("enqueued = %d, unmatched = %d, want 0, 2", stats.Enqueued, stats.Unmatched)
+	}
+	if calls := remote.calls(); len(calls) != 0 {
+		t.Fatalf("calls = %q, want nothing flushed", calls)
+	}
+}
+
+func TestMatchId(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		pattern string
+		path    string
+		want    string
+	}{
+		{"named group", `/v1/(?P<id>[^/]+)/rpc`, "/v1/mainnet/rpc", "mainnet"},
+		{"named group after another group", `/(v1|v2)/(?P<id>[^/]+)/rpc`, "/v2/goerli/rpc", "goerli"},
+		{"numbered group", `^/api/([^/]+)`, "/api/sepolia/blocks", "sepolia"},
+		{"whole match", `[a-f0-9]{8}`, "/keys/deadbeef/rpc", "deadbeef"},
+		{"empty group", `/v1/([^/]*)/rpc`, "/v1//rpc", "/v1//rpc"},
+		{"no match", `^/v1/([^/]+)`, "/health", ""},
+	} {
+		if id := matchId(regexp.MustCompile(test.pattern), test.path); id != test.want {
+			t.Errorf("%s: id = %q, want %q", test.name, id, test.want)
+		}
+	}
+}
+
+func TestAnchorPattern(t *testing.T) {
+	for _, test := range []struct {
+		path               string
+		unanchored, anchor string
+	}{
+		{"/rpc", "/rpc", "/rpc"},
+		{"/not/rpc/really", "/rpc", ""},
+		{"/v1/rpc/extra", "/rpc", ""},
+	} {
+		for _, anchor := range []bool{false, true} {
+			pattern, err := compilePattern("/rpc", anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.unanchored
+			if anchor {
+				want = test.anchor
+			}
+			if id := matchId(pattern, test.path); id != want {
+				t.Errorf("%s anchored %t: id = %q, want %q", test.path, anchor, id, want)
+			}
+		}
+	}
+
+	// the pattern is grouped before anchoring so alternatives and groups keep their meaning
+	pattern, err := compilePattern(`/v1/([^/]+)|/status`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"/v1/mainnet": "mainnet", "/v1/mainnet/rpc": "", "/status": "/status", "/health/status": ""} {
+		if id := matchId(pattern, path); id != want {
+			t.Errorf("%s: id = %q, want %q", path, id, want)
+		}
+	}
+}
+
+func TestSlowMatchThreshold(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, Pattern: `^/([a-z]+[0-9]*)+/rpc$`, SlowMatchThreshold: 1}, nil)
+	logger := &capturingLogger{}
+	a.SetLogger(logger)
+
+	// a long path the pattern scans in full without matching
+	serve(a, "GET", "/"+strings.Repeat("abc123", 20000), "")
+	if slow := a.Stats().SlowMatches; slow != 1 {
+		t.Fatalf("slow matches = %d, want 1", slow)
+	}
+	if records := logger.find("WARNING", "SLOW_MATCH"); len(records) != 1 {
+		t.Fatalf("records = %+v, want the slow match logged", logger.records)
+	}
+
+	a = newTestActivity(t, &Config{RemoteAddress: remote.URL, SlowMatchThreshold: 1000000}, nil)
+	serve(a, "GET", "/node", "")
+	if slow := a.Stats().SlowMatches; slow != 0 {
+		t.Fatalf("slow matches = %d under the threshold, want 0", slow)
+	}
+}
@@ -0,0 +1,118 @@
+package crossover_activity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// pendingBatch is a batch kept in memory until the remote address accepts it, mirrored once it was sent to
+// the mirrors which only get a batch once. the remote address recognizes every send of the batch, retries and
+// resends of the pending batch alike, by its idempotency key, set on its first send
+type pendingBatch struct {
+	entries  []Entry
+	mirrored bool
+	key      string
+}
+
+// pendingBatches failed batches kept in memory to be resent with the next flush, newest first.
+// flushes take the pending batches they resend so concurrent flushes never resend the same batch
+type pendingBatches struct {
+	mu      sync.Mutex
+	batches []pendingBatch
+	max     int
+}
+
+// take removes and returns the pending batches
+func (p *pendingBatches) take() []pendingBatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	batches := p.batches
+	p.batches = nil
+	return batches
+}
+
+// keep adds the failed batches, newest first, dropping the oldest batches beyond max,
+// and returns the number of dropped entries
+func (p *pendingBatches) keep(batches []pendingBatch) int {
+	if p.max == 0 {
+		return pendingLen(batches)
+	}
+	var kept []pendingBatch
+	for _, batch := range batches {
+		if len(batch.entries) != 0 {
+			kept = append(kept, batch)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches = append(kept, p.batches...)
+	dropped := 0
+	if len(p.batches) > p.max {
+		dropped = pendingLen(p.batches[p.max:])
+		p.batches = p.batches[:p.max]
+	}
+	return dropped
+}
+
+// pendingLen returns the number of entries of the pending batches
+func pendingLen(pending []pendingBatch) int {
+	entries := 0
+	for _, batch := range pending {
+		entries += len(batch.entries)
+	}
+	return entries
+}
+
+// keepPending keeps the failed batches pending, entries dropped once the plugin is closing are
+// counted so Close reports them
+func (a *Activity) keepPending(batches []pendingBatch) {
+	dropped := a.pending.keep(batches)
+	if dropped > 0 {
+		a.log().Warn("DROPPED", "entries", dropped, "reason", "pending batches full")
+	}
+	if a.closed.Load() {
+		a.stats.closeDropped.Add(uint64(dropped))
+	}
+}
+
+// flushPending flushes the batch with its idempotency key, set on its first flush
+func (a *Activity) flushPending(ctx context.Context, batch *pendingBatch) error {
+	if len(batch.key) == 0 {
+		key, err := newIdempotencyKey()
+		if err != nil {
+			return err
+		}
+		batch.key = key
+	}
+	mirror := !batch.mirrored
+	batch.mirrored = true
+	return a.flushLogs(ctx, batch.entries, batch.key, mirror)
+}
+
+// newIdempotencyKey returns a random idempotency key for a new batch
+func newIdempotencyKey() (string, error) {
+	return randomHex(16)
+}
+
+// flushBatches flushes the batches one at a time in the calling goroutine, a batch is mirrored the first time
+// it's flushed only. the first failed flush stops the flushes, the failed batch and the batches not flushed yet
+// are kept pending
+func (a *Activity) flushBatches(batches []pendingBatch) {
+	i := 0
+	// a panicking flush must not take down the goroutine flushing every later batch
+	defer func() {
+		if r := recover(); r != nil {
+			a.flushFailed(fmt.Errorf("flush panicked: %v", r), pendingLen(batches[i:]))
+			a.keepPending(batches[i:])
+		}
+	}()
+	for ; i < len(batches); i++ {
+		if err := a.flushPending(a.ctx, &batches[i]); err != nil {
+			a.flushFailed(err, pendingLen(batches[i:]))
+			a.keepPending(batches[i:])
+			return
+		}
+	}
+}
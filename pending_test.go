@@ -0,0 +1,66 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPendingBatchKeepsIdempotencyKey(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress:     remote.URL,
+		FlushInterval:     60,
+		MaxPendingBatches: 10,
+	}, nil)
+
+	remote.setStatus(http.StatusInternalServerError)
+	serve(a, "GET", "/first", "")
+	a.Flush()
+	failed := remote.calls()
+	if len(failed) != 1 || len(failed[0]) == 0 {
+		t.Fatalf("calls = %q, want a single call with an idempotency key", failed)
+	}
+
+	remote.setStatus(http.StatusOK)
+	serve(a, "GET", "/second", "")
+	a.Flush()
+	calls := remote.calls()
+	if len(calls) != 3 {
+		t.Fatalf("calls = %q, want the failed call, the new batch and the pending batch", calls)
+	}
+	if calls[1] == failed[0] || calls[2] != failed[0] {
+		t.Fatalf("calls = %q, want the pending batch resent with its key %q", calls, failed[0])
+	}
+	if remote.count("first") != 1 || remote.count("second") != 1 {
+		t.Fatalf("counts = %d, %d, want 1, 1", remote.count("first"), remote.count("second"))
+	}
+}
+
+func TestPendingBatchesResentOnceCollectorRecovers(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, MaxPendingBatches: 10}, nil)
+
+	remote.setStatus(http.StatusServiceUnavailable)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 5; i++ {
+			serve(a, "GET", "/node", "")
+		}
+		serve(a, "GET", "/other", "")
+		a.Flush()
+	}
+	if count := remote.count("node"); count != 0 {
+		t.Fatalf("count = %d while the collector fails, want 0", count)
+	}
+
+	remote.setStatus(http.StatusOK)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if node, other := remote.count("node"), remote.count("other"); node != 16 || other != 3 {
+		t.Fatalf("counts = %d, %d, want 16, 3", node, other)
+	}
+	// the pending batches were taken by the resend
+	a.Flush()
+	if node := remote.count("node"); node != 16 {
+		t.Fatalf("count = %d after another flush, want 16", node)
+	}
+}
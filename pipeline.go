@@ -0,0 +1,77 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PipelineBufferSize number of batches queued between the pipeline stages
+const PipelineBufferSize = 4
+
+// encodedBatch is a batch encoded by the encoder goroutine waiting to be sent
+type encodedBatch struct {
+	batch       []Entry
+	payload     *bytes.Buffer // from the bufferPool, put back by the sender
+	contentType string
+}
+
+// encoder runs in a separate goroutine and encodes the batches flushed by the batchProcessor
+func (a *Activity) encoder() {
+	for batch := range a.encodeChannel {
+		a.encodePipelined(batch)
+	}
+	close(a.sendChannel)
+}
+
+// encodePipelined encodes the batch and hands it to the sender
+func (a *Activity) encodePipelined(batch []Entry) {
+	// a panicking encoder must not take down the goroutine encoding every later batch
+	defer func() {
+		if r := recover(); r != nil {
+			a.flushFailed(fmt.Errorf("encode panicked: %v", r), len(batch))
+			a.keepPending([]pendingBatch{{entries: batch}})
+		}
+	}()
+	payload, contentType, err := a.encodeBatch(batch)
+	if err != nil {
+		a.flushFailed(err, len(batch))
+		a.keepPending([]pendingBatch{{entries: batch}})
+		return
+	}
+	a.sendChannel <- encodedBatch{batch: batch, payload: payload, contentType: contentType}
+}
+
+// sender runs in a separate goroutine and sends the batches encoded by the encoder
+func (a *Activity) sender() {
+	for encoded := range a.sendChannel {
+		a.sendPipelined(encoded)
+	}
+	close(a.senderDone)
+}
+
+// sendPipelined sends the encoded batch then the pending batches once the remote address is back
+func (a *Activity) sendPipelined(encoded encodedBatch) {
+	defer bufferPool.Put(encoded.payload)
+	key, err := newIdempotencyKey()
+	// a panicking send must not take down the goroutine sending every later batch
+	defer func() {
+		if r := recover(); r != nil {
+			a.flushFailed(fmt.Errorf("flush panicked: %v", r), len(encoded.batch))
+			a.keepPending([]pendingBatch{{entries: encoded.batch, mirrored: true, key: key}})
+		}
+	}()
+	var body []byte
+	if err == nil {
+		body, err = a.send(a.ctx, encoded.payload.Bytes(), encoded.contentType, key, true)
+	}
+	a.notifyFlush(encoded.batch, err)
+	if err != nil {
+		a.flushFailed(err, len(encoded.batch))
+		a.keepPending([]pendingBatch{{entries: encoded.batch, mirrored: true, key: key}})
+		return
+	}
+	a.flushSucceeded(encoded.batch, encoded.payload.Len(), body)
+
+	// the remote address is back, resend the pending batches
+	a.flushBatches(a.pending.take())
+}
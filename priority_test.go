@@ -0,0 +1,32 @@
+package crossover_activity
+
+import (
+	"testing"
+)
+
+func TestPriorityEntriesSurviveBufferPressure(t *testing.T) {
+	remote := newStalledRemote(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress:   remote.URL,
+		FlushInterval:   60,
+		BufferSize:      4,
+		PriorityMethods: []string{"trace_*"},
+	}, nil)
+
+	release := remote.stall(a)
+	for i := 0; i < 10; i++ {
+		serve(a, "POST", "/cheap", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)
+	}
+	for i := 0; i < 3; i++ {
+		serve(a, "POST", "/premium", `{"jsonrpc":"2.0","id":1,"method":"trace_block"}`)
+	}
+	release()
+	a.Flush()
+
+	if dropped := a.Stats().Dropped; dropped != 6 {
+		t.Fatalf("dropped = %d, want 6 cheap entries", dropped)
+	}
+	if premium, cheap := remote.count("premium"), remote.count("cheap"); premium != 3 || cheap != 4 {
+		t.Fatalf("counts = %d, %d, want premium 3 and cheap 4", premium, cheap)
+	}
+}
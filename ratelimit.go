@@ -0,0 +1,108 @@
+package crossover_activity
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiter caps how often the entries of a request id are enqueued with a token bucket per request id,
+// the counts of the entries beyond the rate are held and enqueued along with the next allowed entry
+// or by the batchProcessor on the next flush so no count is lost
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket is the token bucket of a request id along with the entries it holds, keyed like aggregate
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	held   map[Entry]Entry
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow reports whether the entry can be enqueued now and returns the held entries to enqueue along with it,
+// otherwise the entry is held. a nil limiter allows every entry
+func (l *rateLimiter) allow(logEntry Entry) (bool, []Entry) {
+	if l == nil {
+		return true, nil
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[logEntry.RequestId]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[logEntry.RequestId] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, bucket.release(nil)
+	}
+	if bucket.held == nil {
+		bucket.held = make(map[Entry]Entry)
+	}
+	key := logEntry
+	key.Count, key.ReadCount, key.WriteCount, key.enqueued = 0, 0, 0, 0
+	held, ok := bucket.held[key]
+	if !ok {
+		held = key
+	}
+	held.Count += logEntry.Count
+	held.ReadCount += logEntry.ReadCount
+	held.WriteCount += logEntry.WriteCount
+	bucket.held[key] = held
+	return false, nil
+}
+
+// release appends the held entries to entries and forgets them
+func (b *tokenBucket) release(entries []Entry) []Entry {
+	for _, held := range b.held {
+		entries = append(entries, held)
+	}
+	b.held = nil
+	return entries
+}
+
+// drain returns every held entry and forgets the buckets refilled to the burst, which hold nothing
+func (l *rateLimiter) drain() []Entry {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var entries []Entry
+	for requestId, bucket := range l.buckets {
+		entries = bucket.release(entries)
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, requestId)
+		}
+	}
+	return entries
+}
+
+// drainLimiter adds the entries held by the rate limiter to the batch, it's called by the batchProcessor
+func (a *Activity) drainLimiter() {
+	for _, logEntry := range a.limiter.drain() {
+		a.addEntry(logEntry)
+	}
+}
@@ -0,0 +1,47 @@
+package crossover_activity
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestEnqueueRateKeepsCounts(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, EnqueueRate: 1, EnqueueBurst: 2}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 250; j++ {
+				serve(a, "GET", "/node", "")
+			}
+		}()
+	}
+	wg.Wait()
+	serve(a, "GET", "/other", "")
+
+	stats := a.Stats()
+	// the burst, maybe a token refilled meanwhile, and the other request id which has its own bucket
+	if stats.Enqueued > 4 {
+		t.Errorf("enqueued = %d, want the flood throttled", stats.Enqueued)
+	}
+	if stats.RateLimited+stats.Enqueued != 1001 {
+		t.Errorf("rate limited %d and enqueued %d, want 1001 requests in all", stats.RateLimited, stats.Enqueued)
+	}
+
+	a.Flush()
+	if node, other := c.count("node"), c.count("other"); node != 1000 || other != 1 {
+		t.Errorf("counts = %d, %d, want 1000, 1", node, other)
+	}
+}
+
+func TestEnqueueRateMustNotBeNegative(t *testing.T) {
+	if err := configError(&Config{EnqueueRate: -1}); err == nil {
+		t.Error("a negative EnqueueRate was accepted")
+	}
+	if err := configError(&Config{EnqueueRate: 1, EnqueueBurst: -1}); err == nil {
+		t.Error("a negative EnqueueBurst was accepted")
+	}
+}
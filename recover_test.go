@@ -0,0 +1,97 @@
+package crossover_activity
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPanickingOnFlushHook(t *testing.T) {
+	for _, pipelined := range []bool{false, true} {
+		c := newCollector(t)
+		// Flush flushes in the batchProcessor, full batches go through the pipeline
+		a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, BatchSize: 1, PipelinedEncoding: pipelined,
+			MaxPendingBatches: 1}, nil)
+		a.SetOnFlush(func([]Entry, int) { panic("hook") })
+
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		waitFor(t, time.Second, func() bool { return c.count("node") >= 2 })
+		// a sent batch kept pending because of the hook would be resent with the next flush
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		waitFor(t, time.Second, func() bool { return c.count("node") >= 3 })
+		if count := c.count("node"); count != 3 {
+			t.Errorf("pipelined %v: count = %d, want 3", pipelined, count)
+		}
+	}
+}
+
+// panickingEncoder panics on the first batch and encodes the later ones as a JSON array
+type panickingEncoder struct {
+	panicked bool
+}
+
+func (e *panickingEncoder) Encode(w io.Writer, batch []Entry) (string, error) {
+	if !e.panicked {
+		e.panicked = true
+		panic("encoder")
+	}
+	return jsonArrayEncoder{}.Encode(w, batch)
+}
+
+func TestPanickingEncoderKeepsBatchPending(t *testing.T) {
+	for _, pipelined := range []bool{false, true} {
+		c := newCollector(t)
+		a := newTestActivity(t, &Config{
+			RemoteAddress: c.URL, FlushInterval: 60, BatchSize: 1, PipelinedEncoding: pipelined, MaxPendingBatches: 1,
+		}, nil)
+		a.SetEncoder(&panickingEncoder{})
+
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		waitFor(t, time.Second, func() bool { return a.Stats().FailedFlushes == 1 })
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		waitFor(t, time.Second, func() bool { return c.count("node") == 2 })
+	}
+}
+
+func TestUnreachableRemoteAddress(t *testing.T) {
+	c := newCollector(t)
+	c.Close()
+	a, err := New(context.Background(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		&Config{RemoteAddress: c.URL, APIKey: "test", Pattern: "^/([^/]+)", FlushInterval: 60, Timeout: 1,
+			MaxPendingBatches: 2}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	activity := a.(*Activity)
+
+	for i := 0; i < 3; i++ {
+		if status := serve(activity, "GET", "/node", "").Code; status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		activity.Flush()
+	}
+	if stats := activity.Stats(); stats.FailedFlushes == 0 || stats.FlushedEntries != 0 {
+		t.Errorf("stats = %+v, want failed flushes only", stats)
+	}
+	activity.pending.mu.Lock()
+	pending := len(activity.pending.batches)
+	activity.pending.mu.Unlock()
+	if pending != 2 {
+		t.Errorf("pending batches = %d, want MaxPendingBatches", pending)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := activity.Close(ctx); errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close didn't return with the remote address unreachable: %v", err)
+	}
+}
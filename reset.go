@@ -0,0 +1,48 @@
+package crossover_activity
+
+// Reset discards the entries buffered in the channels, the current batches, the pending batches, the entries
+// held by the rate limiter and those waiting in OverflowPath, closes the circuit breakers and zeroes the counters,
+// so tests can reuse the plugin across cases.
+// the goroutines keep running. it's meant for tests and isn't safe to call while requests are served
+// or flushes are in flight, their entries and counts may survive it. it returns right away once closed
+func (a *Activity) Reset() {
+	reset := make(chan struct{})
+	select {
+	case a.resetRequests <- reset:
+		<-reset
+	case <-a.stopped:
+	}
+}
+
+// discard drops every entry the batchProcessor owns or may receive, it's only called by the batchProcessor
+func (a *Activity) discard() {
+	for {
+		select {
+		case <-a.priorityChannel:
+			continue
+		case <-a.logsChannel:
+			continue
+		default:
+		}
+		break
+	}
+	a.limiter.drain()
+	if a.sketch != nil {
+		a.sketch.drain()
+	}
+	a.resetBatch()
+	a.takeRouteBatches()
+	a.pending.take()
+	a.dedup.reset()
+	if err := a.overflow.reset(); err != nil {
+		a.log().Error("OVERFLOW", "error", err)
+	}
+
+	a.stats.reset()
+	a.flushLatency.reset()
+	for _, e := range append([]*endpoint{a.primary}, a.mirrors...) {
+		e.flushed.Store(0)
+		e.failed.Store(0)
+		e.breaker.reset()
+	}
+}
@@ -0,0 +1,46 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResetClosesBreakersAndEmptiesOverflow(t *testing.T) {
+	c := newCollector(t)
+	c.setStatus(http.StatusInternalServerError)
+	path := filepath.Join(t.TempDir(), "overflow")
+	a := newTestActivity(t, &Config{
+		RemoteAddress: c.URL, FlushInterval: 60, BreakerThreshold: 1, OverflowPath: path,
+	}, nil)
+
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if breaker := a.Stats().Endpoints[0].Breaker; breaker != BreakerOpen {
+		t.Fatalf("breaker = %s, want open", breaker)
+	}
+	if !a.overflow.write(Entry{RequestId: "node", Count: 1}) {
+		t.Fatal("overflow entry not written")
+	}
+
+	a.Reset()
+	if breaker := a.Stats().Endpoints[0].Breaker; breaker != BreakerClosed {
+		t.Errorf("breaker = %s, want closed", breaker)
+	}
+	if pending := a.overflow.pending(); pending != 0 {
+		t.Errorf("overflow pending = %d bytes, want 0", pending)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if info.Size() != 0 {
+		t.Errorf("overflow file = %d bytes, want empty", info.Size())
+	}
+
+	c.setStatus(http.StatusOK)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if count := c.count("node"); count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+}
@@ -0,0 +1,58 @@
+package crossover_activity
+
+import (
+	"errors"
+)
+
+var errClosed = errors.New("plugin is closed")
+
+// resizeRequest asks the batchProcessor to swap the logs channel, done is closed once it's swapped
+type resizeRequest struct {
+	logs chan Entry
+	done chan struct{}
+}
+
+// Resize replaces the logs channel with one buffering bufferSize entries and returns once it's in use.
+// the entries buffered in the old channel move to the new one, those it has no room for are added to the
+// batch right away so none is lost or recorded twice. requests being enqueued while the channels are swapped
+// wait for the swap, which only takes a lock, and are sent to the new channel
+func (a *Activity) Resize(bufferSize int) error {
+	if bufferSize <= 0 {
+		return errors.New("BufferSize must be positive")
+	}
+	r := resizeRequest{logs: make(chan Entry, bufferSize), done: make(chan struct{})}
+	select {
+	case a.resizeRequests <- r:
+		<-r.done
+		return nil
+	case <-a.stopped:
+		return errClosed
+	}
+}
+
+// swapLogs swaps the logs channel and moves the entries of the old channel to the new one, it's only
+// called by the batchProcessor which is the only goroutine receiving from the logs channel
+func (a *Activity) swapLogs(logs chan Entry) {
+	a.logsMu.Lock()
+	old := a.logsChannel
+	a.logsChannel = logs
+	a.logsMu.Unlock()
+
+	// no entry is sent to the old channel once the lock is released
+	close(old)
+	for logEntry := range old {
+		select {
+		case logs <- logEntry:
+		default:
+			a.addEntry(logEntry)
+		}
+	}
+}
+
+// logs returns the logs channel, to be used by the goroutines other than the batchProcessor
+// which don't send to it, senders hold logsMu while they send
+func (a *Activity) logs() chan Entry {
+	a.logsMu.RLock()
+	defer a.logsMu.RUnlock()
+	return a.logsChannel
+}
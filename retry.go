@@ -0,0 +1,131 @@
+package crossover_activity
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultRetryBaseDelay = 100 * time.Millisecond // delay before the first retry
+	DefaultRetryMaxDelay  = 5 * time.Second        // cap of the delay between two retries
+	DefaultMaxRetryWindow = 30                     // seconds bounding a flush and all its retries
+)
+
+// retry jitter strategies
+const (
+	JitterNone         = "none"
+	JitterFull         = "full"
+	JitterEqual        = "equal"
+	JitterDecorrelated = "decorrelated"
+)
+
+// backoff computes the delays between the retries of one flush, with exp = min(max, base * 2^attempt):
+//   - none:         exp
+//   - full:         random between 0 and exp
+//   - equal:        exp/2 + random between 0 and exp/2
+//   - decorrelated: min(max, random between base and 3 * previous delay)
+type backoff struct {
+	strategy string
+	base     time.Duration
+	max      time.Duration
+	prev     time.Duration
+}
+
+func newBackoff(strategy string) *backoff {
+	return &backoff{
+		strategy: strategy,
+		base:     DefaultRetryBaseDelay,
+		max:      DefaultRetryMaxDelay,
+		prev:     DefaultRetryBaseDelay,
+	}
+}
+
+// delay returns the delay before the given retry attempt, starting at 0
+func (b *backoff) delay(attempt int) time.Duration {
+	exp := b.max
+	if attempt < 32 && b.base<<uint(attempt) < b.max {
+		exp = b.base << uint(attempt)
+	}
+
+	switch b.strategy {
+	case JitterFull:
+		return randDuration(0, exp)
+	case JitterEqual:
+		return exp/2 + randDuration(0, exp/2)
+	case JitterDecorrelated:
+		next := randDuration(b.base, 3*b.prev)
+		if next > b.max {
+			next = b.max
+		}
+		b.prev = next
+		return next
+	default:
+		return exp
+	}
+}
+
+// randDuration returns a random duration in [min, max]
+func randDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)+1))
+}
+
+// send posts the payload with the idempotency key of its batch, retrying failed calls up to maxRetries times
+// with backoff between them, all the attempts are bounded by the retry window. the payload is mirrored if mirror is set
+func (a *Activity) send(ctx context.Context, payload []byte, contentType, idempotencyKey string, mirror bool) ([]byte, error) {
+	if a.dryRun {
+		a.logDryRun(payload, contentType)
+		return nil, nil
+	}
+	if mirror {
+		a.mirror(payload, contentType, idempotencyKey)
+	}
+	return a.sendTo(ctx, a.primary, payload, contentType, idempotencyKey)
+}
+
+// sendTo posts the payload to the endpoint with the retries of send and counts the outcome
+func (a *Activity) sendTo(ctx context.Context, e *endpoint, payload []byte, contentType, idempotencyKey string) ([]byte, error) {
+	if !e.breaker.allow() {
+		e.failed.Add(1)
+		return nil, errCircuitOpen
+	}
+	body, err := a.retry(ctx, e.address, payload, contentType, idempotencyKey)
+	e.breaker.record(err)
+	if err != nil {
+		e.failed.Add(1)
+		return nil, err
+	}
+	e.flushed.Add(1)
+	return body, nil
+}
+
+// retry posts the payload to the address, retrying failed calls up to maxRetries times within the retry window
+func (a *Activity) retry(ctx context.Context, address string, payload []byte, contentType, idempotencyKey string) ([]byte, error) {
+	if a.maxRetries > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.retryWindow)
+		defer cancel()
+	}
+
+	b := newBackoff(a.jitterStrategy)
+	for attempt := 0; ; attempt++ {
+		body, err := a.sendPayload(ctx, address, payload, contentType, idempotencyKey)
+		if err == nil || attempt >= a.maxRetries {
+			return body, err
+		}
+
+		delay := b.delay(attempt)
+		a.log().Warn("FLUSH_LOGS", "remote_address", address, "attempt", attempt+1, "retry_in", delay, "status", statusCode(err), "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("giving up after %d attempts, %s: %w", attempt+1, ctx.Err(), err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelays(t *testing.T) {
+	base, max := DefaultRetryBaseDelay, DefaultRetryMaxDelay
+	exp := func(attempt int) time.Duration {
+		if d := base << uint(attempt); d < max {
+			return d
+		}
+		return max
+	}
+	tests := []struct {
+		strategy string
+		bounds   func(attempt int, prev time.Duration) (time.Duration, time.Duration)
+	}{
+		{JitterNone, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			return exp(attempt), exp(attempt)
+		}},
+		{JitterFull, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			return 0, exp(attempt)
+		}},
+		{JitterEqual, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			return exp(attempt) / 2, exp(attempt)
+		}},
+		{JitterDecorrelated, func(_ int, prev time.Duration) (time.Duration, time.Duration) {
+			if 3*prev < max {
+				return base, 3 * prev
+			}
+			return base, max
+		}},
+	}
+	for _, test := range tests {
+		for run := 0; run < 100; run++ {
+			b := newBackoff(test.strategy)
+			prev := base
+			for attempt := 0; attempt < 10; attempt++ {
+				low, high := test.bounds(attempt, prev)
+				delay := b.delay(attempt)
+				if delay < low || delay > high {
+					t.Fatalf("%s: delay of attempt %d = %s, want between %s and %s", test.strategy, attempt, delay, low, high)
+				}
+				prev = delay
+			}
+		}
+	}
+}
+
+func TestJitterStrategyMustBeKnown(t *testing.T) {
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", JitterStrategy: "random"}); err == nil {
+		t.Fatal("want an error for JitterStrategy random")
+	}
+}
+
+// flakyRemote is a remote address failing the first calls with 503, it counts the calls received
+func flakyRemote(t *testing.T, failures int32, calls *atomic.Int32) *httptest.Server {
+	remote := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) <= failures {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(remote.Close)
+	return remote
+}
+
+func TestFlushRetries(t *testing.T) {
+	var calls atomic.Int32
+	remote := flakyRemote(t, 2, &calls)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, MaxRetries: 3, JitterStrategy: JitterNone}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("calls = %d, want 2 failures and the successful retry", n)
+	}
+	if stats := a.Stats(); stats.FailedFlushes != 0 || stats.FlushedEntries != 1 {
+		t.Fatalf("failed flushes = %d, flushed entries = %d, want 0, 1", stats.FailedFlushes, stats.FlushedEntries)
+	}
+}
+
+func TestFlushRetriesExhausted(t *testing.T) {
+	var calls atomic.Int32
+	remote := flakyRemote(t, 1000, &calls)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, MaxRetries: 2, JitterStrategy: JitterNone}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("calls = %d, want the call and 2 retries", n)
+	}
+	if failed := a.Stats().FailedFlushes; failed != 1 {
+		t.Fatalf("failed flushes = %d, want 1", failed)
+	}
+}
+
+func TestMaxRetryWindowBoundsRetries(t *testing.T) {
+	var calls atomic.Int32
+	remote := flakyRemote(t, 1000, &calls)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, MaxRetries: 1000, MaxRetryWindow: 1}, nil)
+	serve(a, "GET", "/node", "")
+	start := time.Now()
+	a.Flush()
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("flush took %s, want it bounded by the 1s window", elapsed)
+	}
+	if n := calls.Load(); n < 2 || n >= 1000 {
+		t.Fatalf("calls = %d, want retries cut short by the window", n)
+	}
+}
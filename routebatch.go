@@ -0,0 +1,93 @@
+package crossover_activity
+
+import (
+	"fmt"
+	"time"
+)
+
+// PatternBatch batch settings of the entries matched by a named pattern, zero values fall back to
+// BatchSize and FlushInterval
+type PatternBatch struct {
+	BatchSize     int
+	FlushInterval int
+}
+
+// routeBatch batches the entries of a named pattern apart from the other entries with its own
+// batch size and flush interval
+type routeBatch struct {
+	batch         []Entry
+	batchSize     int
+	flushInterval int
+	timer         *time.Timer
+}
+
+// newRouteBatches validates the PatternBatches overrides and returns their batches by pattern name
+func newRouteBatches(config *Config) (map[string]*routeBatch, error) {
+	if len(config.PatternBatches) == 0 {
+		return nil, nil
+	}
+	batches := make(map[string]*routeBatch, len(config.PatternBatches))
+	for patternName, override := range config.PatternBatches {
+		if _, ok := config.Patterns[patternName]; !ok {
+			return nil, fmt.Errorf("PatternBatches %s isn't one of Patterns", patternName)
+		}
+		if override.BatchSize < 0 {
+			return nil, fmt.Errorf("PatternBatches %s BatchSize can't be negative", patternName)
+		}
+		if override.FlushInterval < 0 {
+			return nil, fmt.Errorf("PatternBatches %s FlushInterval can't be negative", patternName)
+		}
+		r := &routeBatch{batchSize: override.BatchSize, flushInterval: override.FlushInterval}
+		if r.batchSize == 0 {
+			r.batchSize = config.BatchSize
+		}
+		if r.flushInterval == 0 {
+			r.flushInterval = config.FlushInterval
+		}
+		batches[patternName] = r
+	}
+	return batches, nil
+}
+
+// startRouteTimers starts the flush timer of every route batch, an expired timer hands its batch to the
+// batchProcessor through routeExpired which holds one expiration per route so the timers never block
+func (a *Activity) startRouteTimers() {
+	a.routeExpired = make(chan *routeBatch, len(a.routeBatches))
+	for _, r := range a.routeBatches {
+		r := r
+		r.timer = time.AfterFunc(a.flushDelay(r.flushInterval), func() { a.routeExpired <- r })
+	}
+}
+
+// stopRouteTimers stops the flush timers of the route batches
+func (a *Activity) stopRouteTimers() {
+	for _, r := range a.routeBatches {
+		r.timer.Stop()
+	}
+}
+
+// addRouteEntry adds the entry to its route batch and flushes it once it's full
+func (a *Activity) addRouteEntry(r *routeBatch, logEntry Entry) {
+	r.batch = append(r.batch, logEntry)
+	if len(r.batch) >= r.batchSize {
+		a.flushRoute(r)
+	}
+}
+
+// flushRoute flushes the route batch if it's not empty
+func (a *Activity) flushRoute(r *routeBatch) {
+	if len(r.batch) > 0 {
+		a.flush(r.batch)
+		r.batch = nil
+	}
+}
+
+// takeRouteBatches removes and returns the entries of every route batch
+func (a *Activity) takeRouteBatches() []Entry {
+	var batch []Entry
+	for _, r := range a.routeBatches {
+		batch = append(batch, r.batch...)
+		r.batch = nil
+	}
+	return batch
+}
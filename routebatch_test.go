@@ -0,0 +1,57 @@
+package crossover_activity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatternBatches(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: remote.URL,
+		FlushInterval: 60,
+		BatchSize:     100,
+		Pattern:       "^/v1/([^/]+)",
+		Patterns:      map[string]string{"fast": "^/fast/([^/]+)", "bulk": "^/bulk/([^/]+)"},
+		PatternBatches: map[string]PatternBatch{
+			"fast": {FlushInterval: 1},
+			"bulk": {BatchSize: 3},
+		},
+	}, nil)
+
+	start := time.Now()
+	serve(a, "GET", "/fast/quick", "")
+	serve(a, "GET", "/v1/global", "")
+	for i := 0; i < 2; i++ {
+		serve(a, "GET", "/bulk/many", "")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if count := remote.count("many"); count != 0 {
+		t.Fatalf("count = %d before the bulk batch is full, want 0", count)
+	}
+	serve(a, "GET", "/bulk/many", "")
+	waitFor(t, time.Second, func() bool { return remote.count("many") == 3 })
+
+	waitFor(t, 3*time.Second, func() bool { return remote.count("quick") == 1 })
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("fast batch flushed after %s, want its 1s flush interval", elapsed)
+	}
+	if count := remote.count("global"); count != 0 {
+		t.Fatalf("count = %d, want the other entries waiting for the global 60s interval", count)
+	}
+	a.Flush()
+	if count := remote.count("global"); count != 1 {
+		t.Fatalf("count = %d after Flush, want 1", count)
+	}
+}
+
+func TestPatternBatchesMustNameAPattern(t *testing.T) {
+	err := configError(&Config{
+		RemoteAddress:  "http://127.0.0.1:1",
+		Patterns:       map[string]string{"fast": "^/fast/([^/]+)"},
+		PatternBatches: map[string]PatternBatch{"slow": {FlushInterval: 30}},
+	})
+	if err == nil {
+		t.Fatal("want an error for PatternBatches of an unknown pattern")
+	}
+}
@@ -0,0 +1,95 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// JSON-RPC method classes
+const (
+	MethodClassRead  = "read"
+	MethodClassWrite = "write"
+)
+
+// writeMethods built-in JSON-RPC methods classified as write, any other method is a read
+var writeMethods = map[string]bool{
+	"eth_sendRawTransaction":   true,
+	"eth_sendTransaction":      true,
+	"personal_sendTransaction": true,
+	"eth_submitWork":           true,
+	"eth_submitHashrate":       true,
+}
+
+// rpcCall is the part of a JSON-RPC call used to classify activity
+type rpcCall struct {
+	Method string          `json:"method"`
+	Id     json.RawMessage `json:"id"`
+}
+
+// rpcMethods returns the methods of the JSON-RPC call or batch in the body, nil if the body isn't JSON-RPC.
+// idsOnly skips the notifications, calls without a non null id, as the rpc-ids-only CountMode does
+func rpcMethods(body []byte, idsOnly bool) []string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+
+	var calls []rpcCall
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &calls); err != nil {
+			return nil
+		}
+	} else {
+		var call rpcCall
+		if err := json.Unmarshal(body, &call); err != nil {
+			return nil
+		}
+		calls = append(calls, call)
+	}
+
+	methods := make([]string, 0, len(calls))
+	for _, call := range calls {
+		if idsOnly && (len(call.Id) == 0 || string(call.Id) == "null") {
+			continue
+		}
+		methods = append(methods, call.Method)
+	}
+	return methods
+}
+
+// matchMethod reports whether the method matches any of the patterns, a trailing * matches any suffix
+func matchMethod(method string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(method, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// methodClass returns the class of the method, overrides take precedence over the built-in classification
+func methodClass(method string, overrides map[string]string) string {
+	if class, ok := overrides[method]; ok {
+		return class
+	}
+	if writeMethods[method] {
+		return MethodClassWrite
+	}
+	return MethodClassRead
+}
+
+// rpcIdCount counts the decoded calls with a non null id, notifications and elements that aren't objects aren't counted
+func rpcIdCount(calls []interface{}) int {
+	count := 0
+	for _, call := range calls {
+		if object, ok := call.(map[string]interface{}); ok && object["id"] != nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,76 @@
+package crossover_activity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitCountAddsUpToCount(t *testing.T) {
+	const batch = `[{"jsonrpc":"2.0","id":1,"method":"eth_call"},` +
+		`{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction"},` +
+		`{"jsonrpc":"2.0","method":"eth_subscription"},` +
+		`{"jsonrpc":"2.0","id":null,"method":"eth_sendRawTransaction"}]`
+	for _, test := range []struct {
+		name               string
+		config             Config
+		count, read, write int
+	}{
+		{"all", Config{}, 4, 2, 2},
+		{"rpc-ids-only", Config{CountMode: CountModeRPCIds}, 2, 1, 1},
+		{"floor", Config{CountFloors: map[string]int{"node": 10}}, 10, 8, 2},
+		{"floor rpc-ids-only", Config{CountMode: CountModeRPCIds, CountFloors: map[string]int{"node": 10}}, 10, 9, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := newCollector(t)
+			config := test.config
+			config.RemoteAddress, config.FlushInterval, config.SplitReadWrite = c.URL, 60, true
+			var flushed []Entry
+			a := newTestActivity(t, &config, nil)
+			a.SetOnFlush(func(batch []Entry, _ int) { flushed = append(flushed, batch...) })
+
+			serve(a, "POST", "/node", batch)
+			a.Flush()
+			if len(flushed) != 1 {
+				t.Fatalf("flushed = %+v, want 1 entry", flushed)
+			}
+			entry := flushed[0]
+			if entry.Count != test.count || entry.ReadCount != test.read || entry.WriteCount != test.write {
+				t.Errorf("count %d read %d write %d, want %d %d %d",
+					entry.Count, entry.ReadCount, entry.WriteCount, test.count, test.read, test.write)
+			}
+		})
+	}
+}
+
+func TestMethodMaxCount(t *testing.T) {
+	var batch strings.Builder
+	batch.WriteString("[")
+	for i := 0; i < 10; i++ {
+		batch.WriteString(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs"},`)
+	}
+	batch.WriteString(`{"jsonrpc":"2.0","id":2,"method":"eth_chainId"},{"jsonrpc":"2.0","id":3,"method":"eth_chainId"}]`)
+
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress:  c.URL,
+		FlushInterval:  60,
+		MethodMaxCount: map[string]int{"eth_getLogs": 3, "eth_chainId": 5},
+	}, nil)
+	serve(a, "POST", "/node", batch.String())
+	serve(a, "POST", "/node", batch.String())
+	a.Flush()
+	// 3 capped eth_getLogs and the 2 eth_chainId under their cap, per request
+	if count := c.count("node"); count != 10 {
+		t.Fatalf("count = %d, want 10", count)
+	}
+	if clamps := a.Stats().MethodClamps; clamps != 2 {
+		t.Fatalf("clamps = %d, want one per request", clamps)
+	}
+}
+
+func TestMethodMaxCountMustNotBeNegative(t *testing.T) {
+	err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", MethodMaxCount: map[string]int{"eth_getLogs": -1}})
+	if err == nil {
+		t.Fatal("want an error for a negative MethodMaxCount")
+	}
+}
@@ -0,0 +1,46 @@
+package crossover_activity
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// sampler decides which entries are recorded under SampleRate, its RNG is per instance and guarded by a mutex
+type sampler struct {
+	mu    sync.Mutex
+	rng   *rand.Rand
+	rate  float64
+	scale bool
+}
+
+func newSampler(rate float64, scale bool) *sampler {
+	return &sampler{
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		rate:  rate,
+		scale: scale,
+	}
+}
+
+// sample reports whether the entry is recorded, scaling its counts by 1/rate when enabled
+// so the sum of the recorded counts remains an unbiased estimate of the actual activity
+func (s *sampler) sample(logEntry *Entry) bool {
+	if s == nil || s.rate >= 1 {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	keep := s.rng.Float64() < s.rate
+	s.mu.Unlock()
+
+	if keep && s.scale {
+		logEntry.Count = int(math.Round(float64(logEntry.Count) / s.rate))
+		logEntry.ReadCount = int(math.Round(float64(logEntry.ReadCount) / s.rate))
+		logEntry.WriteCount = int(math.Round(float64(logEntry.WriteCount) / s.rate))
+	}
+	return keep
+}
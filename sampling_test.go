@@ -0,0 +1,56 @@
+package crossover_activity
+
+import (
+	"testing"
+)
+
+func TestSampleRate(t *testing.T) {
+	rate := func(r float64) *float64 { return &r }
+	for _, test := range []struct {
+		name     string
+		rate     *float64
+		enqueued uint64
+	}{
+		{"default", nil, 100},
+		{"none", rate(0), 0},
+		{"all", rate(1), 100},
+	} {
+		remote := newCollector(t)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, SampleRate: test.rate}, nil)
+		for i := 0; i < 100; i++ {
+			serve(a, "GET", "/node", "")
+		}
+		a.Flush()
+		if enqueued, count := a.Stats().Enqueued, remote.count("node"); enqueued != test.enqueued || count != int(test.enqueued) {
+			t.Errorf("%s: enqueued = %d, count = %d, want %d", test.name, enqueued, count, test.enqueued)
+		}
+	}
+}
+
+func TestScaleSampledCounts(t *testing.T) {
+	s := newSampler(0.5, true)
+	kept, total := 0, 0
+	for i := 0; i < 10000; i++ {
+		entry := Entry{Count: 1}
+		if s.sample(&entry) {
+			kept++
+			total += entry.Count
+		}
+	}
+	if total != 2*kept {
+		t.Fatalf("total = %d of %d kept entries, want every count scaled to 2", total, kept)
+	}
+	// the scaled total estimates the 10000 requests within a few standard deviations (100)
+	if total < 9400 || total > 10600 {
+		t.Fatalf("total = %d, want about 10000", total)
+	}
+}
+
+func TestSampleRateMustBeFraction(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.5} {
+		rate := rate
+		if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", SampleRate: &rate}); err == nil {
+			t.Errorf("SampleRate %v: want an error", rate)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// SchemaValidationRequestId request id of the sample entry posted by ValidateSchema, it's sent with a zero count
+const SchemaValidationRequestId = "crossover-activity-schema-validation"
+
+// ValidateSchema posts a sample batch to the remote address and checks it was understood,
+// which is a 200 response containing the schema marker when one is configured
+func (a *Activity) ValidateSchema(ctx context.Context) error {
+	sample := []Entry{{RequestId: SchemaValidationRequestId, Count: 0}}
+	body, err := a.postBatch(ctx, sample)
+	if err != nil {
+		return err
+	}
+	if len(a.schemaMarker) != 0 && !bytes.Contains(body, []byte(a.schemaMarker)) {
+		return fmt.Errorf("response doesn't contain the schema marker %q, body: %s", a.schemaMarker, string(body))
+	}
+	return nil
+}
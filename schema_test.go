@@ -0,0 +1,77 @@
+package crossover_activity
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// schemaCollector is a remote address responding to every call with the status and body
+func schemaCollector(t *testing.T, status int, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(status)
+		_, _ = io.WriteString(rw, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		marker string
+		valid  bool
+	}{
+		{"accepted", http.StatusOK, "", "", true},
+		{"accepted with the marker", http.StatusOK, `{"schema":"v1"}`, `"schema":"v1"`, true},
+		{"accepted without the marker", http.StatusOK, `{}`, `"schema":"v1"`, false},
+		{"rejected", http.StatusBadRequest, `unknown field request_id`, "", false},
+	}
+	for _, test := range tests {
+		remote := schemaCollector(t, test.status, test.body)
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, SchemaMarker: test.marker}, nil)
+		if err := a.ValidateSchema(context.Background()); (err == nil) != test.valid {
+			t.Errorf("%s: err = %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
+
+// syncBuffer is a buffer safe to write from the plugin goroutines while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestValidateSchemaOnStartWarns(t *testing.T) {
+	output := &syncBuffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	remote := schemaCollector(t, http.StatusUnprocessableEntity, "")
+	newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, ValidateSchemaOnStart: true}, nil)
+	waitFor(t, 5*time.Second, func() bool {
+		return strings.Contains(output.String(), "SCHEMA_VALIDATION")
+	})
+}
@@ -0,0 +1,81 @@
+package crossover_activity
+
+import (
+	"context"
+	"fmt"
+)
+
+// Close stops accepting new entries, flushes the entries remaining in the channels, the current
+// batch and the pending batches, and returns once the final flush completes. once ctx is done the
+// flushes in flight are aborted, the remaining entries are dropped and the returned error wraps
+// ctx.Err() with the number of dropped entries. it's safe to call more than once.
+// it's called once the New context is cancelled, which also aborts the flushes in flight
+func (a *Activity) Close(ctx context.Context) error {
+	a.closeOnce.Do(func() {
+		a.closed.Store(true)
+		close(a.done)
+	})
+
+	interrupted := false
+	select {
+	case <-a.stopped:
+	case <-ctx.Done():
+		// abort the flushes in flight, the remaining flushes fail fast
+		interrupted = true
+		a.cancel()
+		<-a.stopped
+	}
+	a.releaseOnce.Do(func() {
+		a.cancel()
+		a.closeErr = a.audit.close()
+		if err := a.overflow.close(); err != nil && a.closeErr == nil {
+			a.closeErr = err
+		}
+	})
+
+	dropped := a.stats.closeDropped.Load()
+	if interrupted {
+		return fmt.Errorf("closing %s interrupted, %d entries dropped: %w", a.name, dropped, ctx.Err())
+	}
+	if dropped > 0 {
+		return fmt.Errorf("closing %s, %d entries dropped", a.name, dropped)
+	}
+	return a.closeErr
+}
+
+// drain flushes the entries left in the channels once the batchProcessor is asked to stop,
+// then waits for the in flight flushes and resends the pending batches a last time
+func (a *Activity) drain() {
+	if a.overflowDone != nil {
+		// nothing must be replayed into the channels once they're drained
+		<-a.overflowDone
+	}
+drainChannels:
+	for {
+		select {
+		case logEntry := <-a.priorityChannel:
+			a.addEntry(logEntry)
+		case logEntry := <-a.logsChannel:
+			a.addEntry(logEntry)
+		default:
+			break drainChannels
+		}
+	}
+	a.drainLimiter()
+	a.flushSketch()
+	a.flushBatch()
+	a.stopRouteTimers()
+	for _, r := range a.routeBatches {
+		a.flushRoute(r)
+	}
+
+	if a.encodeChannel != nil {
+		close(a.encodeChannel)
+		<-a.senderDone
+	}
+	a.flushWorkers.Wait()
+	a.workers.Wait()
+	a.flushNow(nil)
+	a.mirrorsWG.Wait()
+	a.stats.closeDropped.Add(uint64(pendingLen(a.pending.take())))
+}
@@ -0,0 +1,53 @@
+package crossover_activity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// signing headers, the signature is the hex HMAC-SHA256 of "<timestamp>.<nonce>.<payload>"
+const (
+	TimestampHeader = "X-Timestamp"
+	NonceHeader     = "X-Nonce"
+	SignatureHeader = "X-Signature"
+)
+
+// signRequest signs the payload with a fresh timestamp and a random nonce so the remote address
+// can reject stale or replayed submissions
+func (a *Activity) signRequest(httpReq *http.Request, payload []byte) error {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	httpReq.Header.Set(TimestampHeader, timestamp)
+	httpReq.Header.Set(NonceHeader, nonce)
+	httpReq.Header.Set(SignatureHeader, signature(a.signingSecret, timestamp, nonce, payload))
+	return nil
+}
+
+// signature returns the hex HMAC-SHA256 of the timestamp, nonce and payload
+func signature(secret []byte, timestamp, nonce string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,86 @@
+package crossover_activity
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// signedCall is a call received by the remote address with its signing headers
+type signedCall struct {
+	timestamp, nonce, signature string
+	payload                     []byte
+}
+
+func TestSignedBatches(t *testing.T) {
+	const secret = "s3cret"
+	var mu sync.Mutex
+	var calls []signedCall
+	remote := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		payload, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, signedCall{
+			timestamp: req.Header.Get(TimestampHeader),
+			nonce:     req.Header.Get(NonceHeader),
+			signature: req.Header.Get(SignatureHeader),
+			payload:   payload,
+		})
+	}))
+	defer remote.Close()
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, SigningSecret: secret}, nil)
+
+	for i := 0; i < 3; i++ {
+		serve(a, "GET", "/node", "")
+		a.Flush()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 3 {
+		t.Fatalf("calls = %d, want 3", len(calls))
+	}
+	nonces := map[string]bool{}
+	for _, call := range calls {
+		if nonces[call.nonce] {
+			t.Fatalf("nonce %q reused", call.nonce)
+		}
+		nonces[call.nonce] = true
+		seconds, err := strconv.ParseInt(call.timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(seconds, 0)) > time.Minute {
+			t.Fatalf("timestamp = %q, want a fresh unix timestamp", call.timestamp)
+		}
+		if call.signature != signature([]byte(secret), call.timestamp, call.nonce, call.payload) {
+			t.Fatalf("signature %q doesn't match the timestamp, nonce and payload", call.signature)
+		}
+		// a replay with a refreshed timestamp or nonce doesn't match the captured signature
+		stale := strconv.FormatInt(seconds+300, 10)
+		if call.signature == signature([]byte(secret), stale, call.nonce, call.payload) ||
+			call.signature == signature([]byte(secret), call.timestamp, "other", call.payload) {
+			t.Fatal("signature doesn't cover the timestamp and nonce")
+		}
+	}
+}
+
+func TestUnsignedBatches(t *testing.T) {
+	var mu sync.Mutex
+	var header http.Header
+	remote := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		header = req.Header.Clone()
+	}))
+	defer remote.Close()
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	mu.Lock()
+	defer mu.Unlock()
+	if header == nil || len(header.Get(SignatureHeader)) != 0 || len(header.Get(NonceHeader)) != 0 {
+		t.Fatalf("header = %v, want an unsigned call", header)
+	}
+}
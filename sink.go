@@ -0,0 +1,74 @@
+package crossover_activity
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	DefaultSinkMaxKeys = 1000    // distinct request ids recorded by the counter sink
+	SinkOverflowKey    = "other" // request id recording the activity of request ids beyond the max keys
+)
+
+// CounterSink records the flushed counts per request id, it's the extension point to export
+// the activity as metrics, e.g. an adapter adding to an OpenTelemetry Int64Counter with the
+// request id as an attribute. the plugin depends on the standard library only so it ships no adapter
+type CounterSink interface {
+	Add(ctx context.Context, requestId string, count int64)
+}
+
+// counterSink bounds the cardinality of the request ids recorded by the sink
+type counterSink struct {
+	mu      sync.Mutex
+	sink    CounterSink
+	keys    map[string]struct{}
+	maxKeys int
+}
+
+// SetCounterSink records the counts of every batch the remote address accepted into the sink, the entries it
+// rejected aren't recorded until they're accepted. request ids beyond the first maxKeys (DefaultSinkMaxKeys
+// if zero) are recorded under SinkOverflowKey
+func (a *Activity) SetCounterSink(sink CounterSink, maxKeys int) {
+	if maxKeys <= 0 {
+		maxKeys = DefaultSinkMaxKeys
+	}
+	a.counterSink.mu.Lock()
+	defer a.counterSink.mu.Unlock()
+	a.counterSink.sink = sink
+	a.counterSink.keys = make(map[string]struct{})
+	a.counterSink.maxKeys = maxKeys
+}
+
+// record aggregates the counts of the batch but the rejected entries per request id and adds them to the sink
+func (s *counterSink) record(batch, rejected []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sink == nil {
+		return
+	}
+
+	counts := make(map[string]int64)
+	for _, entry := range batch {
+		counts[s.key(entry.RequestId)] += int64(entry.Count)
+	}
+	for _, entry := range rejected {
+		counts[s.key(entry.RequestId)] -= int64(entry.Count)
+	}
+	for key, count := range counts {
+		if count > 0 {
+			s.sink.Add(context.Background(), key, count)
+		}
+	}
+}
+
+// key returns the key the request id is recorded under, the request ids beyond maxKeys share SinkOverflowKey
+func (s *counterSink) key(requestId string) string {
+	if _, ok := s.keys[requestId]; ok {
+		return requestId
+	}
+	if len(s.keys) >= s.maxKeys {
+		return SinkOverflowKey
+	}
+	s.keys[requestId] = struct{}{}
+	return requestId
+}
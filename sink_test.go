@@ -0,0 +1,86 @@
+package crossover_activity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recordingSink is a CounterSink recording the counts added by request id
+type recordingSink struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (s *recordingSink) Add(_ context.Context, requestId string, count int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int64)
+	}
+	s.counts[requestId] += count
+}
+
+func (s *recordingSink) count(requestId string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[requestId]
+}
+
+func TestCounterSinkRecordsAcceptedBatches(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60, SyncPattern: "^/critical"}, nil)
+	sink := &recordingSink{}
+	a.SetCounterSink(sink, 0)
+
+	// the failed batch is dropped without MaxPendingBatches
+	c.setStatus(http.StatusInternalServerError)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if count := sink.count("node"); count != 0 {
+		t.Fatalf("count = %d of a failed batch, want 0", count)
+	}
+
+	c.setStatus(http.StatusOK)
+	serve(a, "GET", "/node", "")
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	serve(a, "GET", "/critical", "")
+	if node, critical := sink.count("node"), sink.count("critical"); node != 2 || critical != 1 {
+		t.Fatalf("counts = %d, %d, want the accepted 2 and the synchronously recorded 1", node, critical)
+	}
+}
+
+func TestCounterSinkSkipsRejectedEntries(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{"accepted":1,"rejected":1,"rejected_indexes":[1]}`))
+	}))
+	defer remote.Close()
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	sink := &recordingSink{}
+	a.SetCounterSink(sink, 0)
+
+	serve(a, "GET", "/accepted", "")
+	serve(a, "GET", "/rejected", "")
+	a.Flush()
+	if accepted, rejected := sink.count("accepted"), sink.count("rejected"); accepted != 1 || rejected != 0 {
+		t.Fatalf("counts = %d, %d, want the accepted entry only", accepted, rejected)
+	}
+}
+
+func TestCounterSinkMaxKeys(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: c.URL, FlushInterval: 60}, nil)
+	sink := &recordingSink{}
+	a.SetCounterSink(sink, 2)
+
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/a"} {
+		serve(a, "GET", path, "")
+	}
+	a.Flush()
+	if a, b, other := sink.count("a"), sink.count("b"), sink.count(SinkOverflowKey); a != 2 || b != 1 || other != 2 {
+		t.Fatalf("counts = %d, %d, %d, want 2, 1 and 2 under %s", a, b, other, SinkOverflowKey)
+	}
+}
@@ -0,0 +1,89 @@
+package crossover_activity
+
+import (
+	"unicode/utf8"
+)
+
+// entrySize returns the size of the entry encoded as a JSON object, a separator included, without encoding it.
+// it follows the json tags of Entry, the fields left out when empty only count when they're set. aggregation
+// only shrinks the batch so the sum of the sizes of its entries bounds the size of the payload
+func entrySize(logEntry Entry) int {
+	// braces and the separator
+	size := 3
+	size += jsonFieldSize("request_id", jsonStringSize(logEntry.RequestId))
+	size += jsonFieldSize("count", jsonIntSize(logEntry.Count))
+	size += jsonFieldSize("method", jsonStringSize(logEntry.Method))
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"body", logEntry.Body},
+		{"bucket", logEntry.Bucket},
+		{"pattern", logEntry.Pattern},
+		{"type", logEntry.Type},
+		{"tenant", logEntry.Tenant},
+		{"client_ip", logEntry.ClientIP},
+		{"timestamp", logEntry.Timestamp},
+		{"path", logEntry.Path},
+	} {
+		if len(field.value) != 0 {
+			size += jsonFieldSize(field.name, jsonStringSize(field.value))
+		}
+	}
+	if logEntry.ReadCount != 0 {
+		size += jsonFieldSize("read_count", jsonIntSize(logEntry.ReadCount))
+	}
+	if logEntry.WriteCount != 0 {
+		size += jsonFieldSize("write_count", jsonIntSize(logEntry.WriteCount))
+	}
+	// the fields are separated by commas
+	return size - 1
+}
+
+// jsonFieldSize returns the size of the field with its quoted name, colon and trailing comma
+func jsonFieldSize(name string, valueSize int) int {
+	return len(name) + 4 + valueSize
+}
+
+// jsonStringSize returns the size of the string quoted and escaped by encoding/json: quotes and backslashes take
+// 2 bytes, control characters 2 or 6, the HTML characters <, > and &, U+2028 and U+2029 6. invalid UTF-8 bytes
+// take 6, the size of the escaped replacement character which some go versions write as is in 3 bytes
+func jsonStringSize(s string) int {
+	size := 2
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\' || c == '\n' || c == '\r' || c == '\t':
+				size += 2
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				size += 6
+			default:
+				size++
+			}
+			i++
+			continue
+		}
+		r, width := utf8.DecodeRuneInString(s[i:])
+		if (r == utf8.RuneError && width == 1) || r == '\u2028' || r == '\u2029' {
+			size += 6
+		} else {
+			size += width
+		}
+		i += width
+	}
+	return size
+}
+
+// jsonIntSize returns the number of digits of n, its sign included
+func jsonIntSize(n int) int {
+	size := 1
+	if n < 0 {
+		size++
+		n = -n
+	}
+	for ; n >= 10; n /= 10 {
+		size++
+	}
+	return size
+}
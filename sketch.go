@@ -0,0 +1,87 @@
+package crossover_activity
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+const (
+	DefaultSketchWidth   = 2048    // counters per row, bounds the overestimate to e/width of the total count
+	DefaultSketchDepth   = 4       // rows, bounds the probability of exceeding the error to e^-depth
+	DefaultSketchMaxKeys = 10000   // distinct keys reported per flush
+	SketchOverflowKey    = "other" // key reporting the activity of keys beyond the max keys
+)
+
+// countMinSketch approximates per key counts in a fixed width*depth counters memory.
+// estimates never undercount, and overcount by at most e/width of the total count with probability 1-e^-depth
+type countMinSketch struct {
+	width    uint64
+	counters [][]uint64
+	keys     map[string]struct{} // keys reported on drain, bounded by maxKeys
+	maxKeys  int
+	overflow int // exact count of keys beyond maxKeys
+}
+
+func newCountMinSketch(width, depth, maxKeys int) *countMinSketch {
+	counters := make([][]uint64, depth)
+	for i := range counters {
+		counters[i] = make([]uint64, width)
+	}
+	return &countMinSketch{
+		width:    uint64(width),
+		counters: counters,
+		keys:     make(map[string]struct{}),
+		maxKeys:  maxKeys,
+	}
+}
+
+// index returns the counter of the key in the given row, each row is hashed with a different seed
+func (s *countMinSketch) index(row int, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(row)})
+	h.Write([]byte(key))
+	return h.Sum64() % s.width
+}
+
+func (s *countMinSketch) add(key string, count int) {
+	if _, ok := s.keys[key]; !ok {
+		if len(s.keys) >= s.maxKeys {
+			s.overflow += count
+			return
+		}
+		s.keys[key] = struct{}{}
+	}
+	for row := range s.counters {
+		s.counters[row][s.index(row, key)] += uint64(count)
+	}
+}
+
+func (s *countMinSketch) estimate(key string) int {
+	var min uint64 = math.MaxUint64
+	for row := range s.counters {
+		if c := s.counters[row][s.index(row, key)]; c < min {
+			min = c
+		}
+	}
+	return int(min)
+}
+
+// drain returns the approximate count of every tracked key and resets the sketch
+func (s *countMinSketch) drain() []Entry {
+	entries := make([]Entry, 0, len(s.keys)+1)
+	for key := range s.keys {
+		entries = append(entries, Entry{RequestId: key, Count: s.estimate(key)})
+	}
+	if s.overflow > 0 {
+		entries = append(entries, Entry{RequestId: SketchOverflowKey, Count: s.overflow})
+	}
+
+	for row := range s.counters {
+		for i := range s.counters[row] {
+			s.counters[row][i] = 0
+		}
+	}
+	s.keys = make(map[string]struct{})
+	s.overflow = 0
+	return entries
+}
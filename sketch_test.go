@@ -0,0 +1,65 @@
+package crossover_activity
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestSketchWithinErrorBound(t *testing.T) {
+	const width, depth, keys = 256, 4, 2000
+	sketch := newCountMinSketch(width, depth, keys)
+	total := 0
+	for i := 0; i < keys; i++ {
+		sketch.add(strconv.Itoa(i), i%10+1)
+		total += i%10 + 1
+	}
+
+	bound := int(math.E / width * float64(total))
+	exceeded := 0
+	for _, entry := range sketch.drain() {
+		i, _ := strconv.Atoi(entry.RequestId)
+		exact := i%10 + 1
+		if entry.Count < exact {
+			t.Fatalf("estimate of %s = %d, want at least %d", entry.RequestId, entry.Count, exact)
+		}
+		if entry.Count-exact > bound {
+			exceeded++
+		}
+	}
+	// each estimate is within the bound with probability 1-e^-depth, about 98%
+	if limit := int(float64(keys) * 2 * math.Exp(-depth)); exceeded > limit {
+		t.Fatalf("%d estimates over the %d bound, want at most %d", exceeded, bound, limit)
+	}
+	if entries := sketch.drain(); len(entries) != 0 {
+		t.Fatalf("entries = %+v after drain, want none", entries)
+	}
+}
+
+func TestSketchMaxKeys(t *testing.T) {
+	sketch := newCountMinSketch(64, 2, 2)
+	sketch.add("a", 1)
+	sketch.add("b", 2)
+	sketch.add("c", 3)
+	sketch.add("a", 4)
+	counts := map[string]int{}
+	for _, entry := range sketch.drain() {
+		counts[entry.RequestId] = entry.Count
+	}
+	if counts["a"] != 5 || counts["b"] != 2 || counts[SketchOverflowKey] != 3 || len(counts) != 3 {
+		t.Fatalf("counts = %v, want a 5, b 2 and c in %s", counts, SketchOverflowKey)
+	}
+}
+
+func TestSketchModeFlush(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, SketchMode: true}, nil)
+	for i := 0; i < 5; i++ {
+		serve(a, "GET", "/node", "")
+	}
+	serve(a, "GET", "/other", "")
+	a.Flush()
+	if node, other := remote.count("node"), remote.count("other"); node != 5 || other != 1 {
+		t.Fatalf("counts = %d, %d, want 5, 1", node, other)
+	}
+}
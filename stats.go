@@ -0,0 +1,178 @@
+package crossover_activity
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the plugin runtime counters
+type Stats struct {
+	BufferSize       int             `json:"buffer_size"`
+	ChannelLen       int             `json:"channel_len"` // entries waiting in the buffer channel
+	BatchSize        int             `json:"batch_size"`
+	FlushInterval    int             `json:"flush_interval"`
+	Enqueued         uint64          `json:"enqueued"` // entries sent to the channels
+	ParseFailures    uint64          `json:"parse_failures"`
+	MethodClamps     uint64          `json:"method_clamps"`   // requests methods capped by MethodMaxCount
+	Dropped          uint64          `json:"dropped"`         // entries dropped because the channel was full
+	FlushedBatches   uint64          `json:"flushed_batches"` // batches accepted by the remote address
+	FlushedEntries   uint64          `json:"flushed_entries"` // entries of the batches accepted by the remote address
+	FailedFlushes    uint64          `json:"failed_flushes"`
+	Overflowed       uint64          `json:"overflowed"`      // entries appended to OverflowPath because the channel was full
+	RateLimited      uint64          `json:"rate_limited"`    // entries held by EnqueueRate, their counts are enqueued later
+	Rejected         uint64          `json:"rejected"`        // entries the remote address reported as rejected
+	DryRunBatches    uint64          `json:"dry_run_batches"` // batches logged instead of flushed by DryRun
+	DryRunEntries    uint64          `json:"dry_run_entries"`
+	Unmatched        uint64          `json:"unmatched"`         // requests not matching any pattern, which aren't recorded
+	Truncated        uint64          `json:"truncated"`         // request bodies beyond MaxBodySize, counted from their first MaxBodySize bytes
+	SlowMatches      uint64          `json:"slow_matches"`      // paths matched slower than SlowMatchThreshold
+	RejectedRequests uint64          `json:"rejected_requests"` // requests rejected with 503 by RejectWhenFull
+	Deduplicated     uint64          `json:"deduplicated"`      // requests not recorded again because of their DedupHeader
+	Endpoints        []EndpointStats `json:"endpoints"`         // flush counters per remote address, the primary first
+	LastError        string          `json:"last_error,omitempty"`
+}
+
+// stats holds the runtime counters updated concurrently by the plugin goroutines
+type stats struct {
+	parseFailures    atomic.Uint64
+	enqueued         atomic.Uint64
+	methodClamps     atomic.Uint64
+	dropped          atomic.Uint64
+	flushedBatches   atomic.Uint64
+	flushedEntries   atomic.Uint64
+	failedFlushes    atomic.Uint64
+	overflowed       atomic.Uint64
+	rateLimited      atomic.Uint64
+	rejected         atomic.Uint64
+	dryRunBatches    atomic.Uint64
+	dryRunEntries    atomic.Uint64
+	unmatched        atomic.Uint64
+	truncated        atomic.Uint64
+	slowMatches      atomic.Uint64
+	rejectedRequests atomic.Uint64
+	deduplicated     atomic.Uint64
+	closeDropped     atomic.Uint64 // entries that failed to flush once the plugin is closing
+	batchLen         atomic.Int64  // length of the batch owned by the batchProcessor goroutine
+	lastFlushFailed  atomic.Bool   // whether the last flush failed
+	lastFlushTime    atomic.Int64  // unix nanoseconds of the last successful flush
+
+	errMu         sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// setError records the last error of the plugin
+func (s *stats) setError(err error) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+}
+
+// Stats returns a snapshot of the plugin runtime counters
+func (a *Activity) Stats() Stats {
+	a.stats.errMu.Lock()
+	lastError := a.stats.lastError
+	a.stats.errMu.Unlock()
+
+	logs := a.logs()
+	return Stats{
+		BufferSize:       cap(logs),
+		ChannelLen:       len(logs),
+		BatchSize:        a.batchSize,
+		FlushInterval:    a.flushInterval,
+		Enqueued:         a.stats.enqueued.Load(),
+		ParseFailures:    a.stats.parseFailures.Load(),
+		MethodClamps:     a.stats.methodClamps.Load(),
+		Dropped:          a.stats.dropped.Load(),
+		FlushedBatches:   a.stats.flushedBatches.Load(),
+		FlushedEntries:   a.stats.flushedEntries.Load(),
+		FailedFlushes:    a.stats.failedFlushes.Load(),
+		Overflowed:       a.stats.overflowed.Load(),
+		RateLimited:      a.stats.rateLimited.Load(),
+		Rejected:         a.stats.rejected.Load(),
+		DryRunBatches:    a.stats.dryRunBatches.Load(),
+		DryRunEntries:    a.stats.dryRunEntries.Load(),
+		Unmatched:        a.stats.unmatched.Load(),
+		Truncated:        a.stats.truncated.Load(),
+		SlowMatches:      a.stats.slowMatches.Load(),
+		RejectedRequests: a.stats.rejectedRequests.Load(),
+		Deduplicated:     a.stats.deduplicated.Load(),
+		Endpoints:        a.endpointStats(),
+		LastError:        lastError,
+	}
+}
+
+// state is the internal state of the plugin dumped by DumpState
+type state struct {
+	Name          string    `json:"name"`
+	Config        Config    `json:"config"`
+	Stats         Stats     `json:"stats"`
+	BatchLen      int64     `json:"batch_len"`
+	ChannelLen    int       `json:"channel_len"`
+	ChannelCap    int       `json:"channel_cap"`
+	PriorityLen   int       `json:"priority_len"`
+	PriorityCap   int       `json:"priority_cap"`
+	OverflowBytes int64     `json:"overflow_bytes"` // bytes of overflowed entries waiting to be re-enqueued
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+}
+
+// DumpState returns a JSON snapshot of the plugin internal state to be attached to bug reports, secrets are redacted
+func (a *Activity) DumpState() string {
+	logs := a.logs()
+	s := state{
+		Name:          a.name,
+		Config:        a.config,
+		Stats:         a.Stats(),
+		BatchLen:      a.stats.batchLen.Load(),
+		ChannelLen:    len(logs),
+		ChannelCap:    cap(logs),
+		PriorityLen:   len(a.priorityChannel),
+		PriorityCap:   cap(a.priorityChannel),
+		OverflowBytes: a.overflow.pending(),
+	}
+	s.Config.APIKey = "REDACTED"
+	if len(s.Config.SigningSecret) != 0 {
+		s.Config.SigningSecret = "REDACTED"
+	}
+	// extra headers often carry credentials of the remote address, the keys are kept to tell which are set
+	if len(s.Config.ExtraHeaders) != 0 {
+		s.Config.ExtraHeaders = make(map[string]string, len(a.config.ExtraHeaders))
+		for name := range a.config.ExtraHeaders {
+			s.Config.ExtraHeaders[name] = "REDACTED"
+		}
+	}
+
+	a.stats.errMu.Lock()
+	s.LastError = a.stats.lastError
+	s.LastErrorTime = a.stats.lastErrorTime
+	a.stats.errMu.Unlock()
+
+	dump, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(dump)
+}
+
+// reset zeroes the counters and forgets the last error
+func (s *stats) reset() {
+	for _, counter := range []*atomic.Uint64{
+		&s.parseFailures, &s.enqueued, &s.methodClamps, &s.dropped, &s.flushedBatches, &s.flushedEntries,
+		&s.failedFlushes, &s.overflowed, &s.rateLimited, &s.rejected, &s.dryRunBatches, &s.dryRunEntries,
+		&s.unmatched, &s.truncated, &s.slowMatches, &s.rejectedRequests, &s.deduplicated, &s.closeDropped,
+	} {
+		counter.Store(0)
+	}
+	s.batchLen.Store(0)
+	s.lastFlushFailed.Store(false)
+	s.lastFlushTime.Store(0)
+
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	s.lastError = ""
+	s.lastErrorTime = time.Time{}
+}
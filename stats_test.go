@@ -0,0 +1,29 @@
+package crossover_activity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDumpStateRedactsSecrets(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: c.URL,
+		APIKey:        "api-secret",
+		SigningSecret: "signing-secret",
+		ExtraHeaders:  map[string]string{"Authorization": "Bearer header-secret"},
+	}, nil)
+
+	dump := a.DumpState()
+	for _, secret := range []string{"api-secret", "signing-secret", "header-secret"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("DumpState contains %q:\n%s", secret, dump)
+		}
+	}
+	if !strings.Contains(dump, `"Authorization": "REDACTED"`) {
+		t.Errorf("DumpState doesn't list the redacted Authorization header:\n%s", dump)
+	}
+	if a.extraHeaders["Authorization"] != "Bearer header-secret" {
+		t.Errorf("DumpState changed the extra headers sent to %q", a.extraHeaders["Authorization"])
+	}
+}
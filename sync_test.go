@@ -0,0 +1,60 @@
+package crossover_activity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFailClosed(t *testing.T) {
+	c := newCollector(t)
+	c.setStatus(http.StatusInternalServerError)
+	served := 0
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served++ })
+	a := newTestActivity(t, &Config{
+		RemoteAddress: c.URL, FlushInterval: 60, SyncPattern: "^/critical", FailClosed: true,
+	}, next)
+
+	if status := serve(a, "POST", "/critical", "").Code; status != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", status)
+	}
+	if served != 0 {
+		t.Errorf("next served the critical request the activity of which wasn't recorded")
+	}
+	if status := serve(a, "POST", "/other", "").Code; status != http.StatusOK || served != 1 {
+		t.Errorf("status = %d and served %d, want the other request served", status, served)
+	}
+
+	c.setStatus(http.StatusOK)
+	if status := serve(a, "POST", "/critical", "").Code; status != http.StatusOK || served != 2 {
+		t.Errorf("status = %d and served %d, want the critical request served", status, served)
+	}
+	// recorded before it was served, without waiting for a flush
+	if count := c.count("critical"); count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+}
+
+func TestFailClosedWithinClientPatience(t *testing.T) {
+	c := newCollector(t)
+	a := newTestActivity(t, &Config{
+		RemoteAddress: c.URL, FlushInterval: 60, SyncPattern: "^/critical", FailClosed: true,
+	}, nil)
+
+	// a client that gave up doesn't wait for the collector
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("POST", "/critical", nil).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", recorder.Code)
+	}
+}
+
+func TestFailClosedRequiresSyncPattern(t *testing.T) {
+	if err := configError(&Config{FailClosed: true}); err == nil {
+		t.Fatal("FailClosed was accepted without a SyncPattern")
+	}
+}
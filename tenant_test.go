@@ -0,0 +1,42 @@
+package crossover_activity
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantHeader(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, TenantHeader: "X-Tenant-ID", DefaultTenant: "public"}, nil)
+	for _, tenant := range []string{"acme", "globex", "acme", ""} {
+		req := httptest.NewRequest("GET", "/node", nil)
+		if len(tenant) != 0 {
+			req.Header.Set("x-tenant-id", tenant)
+		}
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	a.Flush()
+
+	counts := map[string]int{}
+	for _, entry := range remote.entries() {
+		if entry.RequestId != "node" {
+			t.Fatalf("entry = %+v, want request id node", entry)
+		}
+		counts[entry.Tenant] += entry.Count
+	}
+	if entries := remote.entries(); len(entries) != 3 || counts["acme"] != 2 || counts["globex"] != 1 || counts["public"] != 1 {
+		t.Fatalf("entries = %+v, want acme 2, globex 1 and public 1 in separate entries", entries)
+	}
+}
+
+func TestNoTenantHeader(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, DefaultTenant: "public"}, nil)
+	req := httptest.NewRequest("GET", "/node", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	a.ServeHTTP(httptest.NewRecorder(), req)
+	a.Flush()
+	if entries := remote.entries(); len(entries) != 1 || len(entries[0].Tenant) != 0 {
+		t.Fatalf("entries = %+v, want no tenant without a TenantHeader", entries)
+	}
+}
@@ -0,0 +1,94 @@
+package crossover_activity
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDisableCountingAndKeying(t *testing.T) {
+	const body = `[{"id":1},{"id":2},{"id":3}]`
+	tests := []struct {
+		name      string
+		counting  bool
+		keying    bool
+		requestId string
+		count     int
+	}{
+		{"both enabled", false, false, "node", 3},
+		{"counting disabled", true, false, "node", 1},
+		{"keying disabled", false, true, "", 3},
+		{"both disabled", true, true, "", 1},
+	}
+	for _, test := range tests {
+		remote := newCollector(t)
+		a := newTestActivity(t, &Config{
+			RemoteAddress:   remote.URL,
+			FlushInterval:   60,
+			DisableCounting: test.counting,
+			DisableKeying:   test.keying,
+		}, nil)
+		serve(a, "POST", "/node", body)
+		a.Flush()
+		entries := remote.entries()
+		if len(entries) != 1 || entries[0].RequestId != test.requestId || entries[0].Count != test.count {
+			t.Errorf("%s: entries = %+v, want %q counting %d", test.name, entries, test.requestId, test.count)
+		}
+	}
+}
+
+func TestDisableKeyingRecordsUnmatchedPaths(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, DisableKeying: true}, nil)
+	serve(a, "GET", "/", "")
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	entries := remote.entries()
+	if len(entries) != 1 || entries[0].RequestId != "" || entries[0].Count != 2 {
+		t.Fatalf("entries = %+v, want both requests under the empty request id", entries)
+	}
+}
+
+func TestCountBodyFalseLeavesBodyUntouched(t *testing.T) {
+	countBody := false
+	for _, count := range []bool{false, true} {
+		remote := newCollector(t)
+		body := io.NopCloser(strings.NewReader(`[{"id":1},{"id":2}]`))
+		var received io.ReadCloser
+		var content []byte
+		next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			received = req.Body
+			content, _ = io.ReadAll(req.Body)
+		})
+		config := &Config{RemoteAddress: remote.URL, FlushInterval: 60}
+		if !count {
+			config.CountBody = &countBody
+		}
+		a := newTestActivity(t, config, next)
+		req := httptest.NewRequest("POST", "/node", nil)
+		req.Header.Set("Content-Type", jsonType)
+		req.Body = body
+		a.ServeHTTP(httptest.NewRecorder(), req)
+		a.Flush()
+
+		if string(content) != `[{"id":1},{"id":2}]` {
+			t.Fatalf("CountBody %t: next read %q, want the whole body", count, content)
+		}
+		if untouched := received == body; untouched == count {
+			t.Errorf("CountBody %t: body passed through untouched %t", count, untouched)
+		}
+		want := 2
+		if !count {
+			want = 1
+		}
+		if got := remote.count("node"); got != want {
+			t.Errorf("CountBody %t: count = %d, want %d", count, got, want)
+		}
+	}
+	countBody = true
+	if err := configError(&Config{RemoteAddress: "http://127.0.0.1:1", CountBody: &countBody, DisableCounting: true}); err == nil {
+		t.Error("want an error for CountBody true with DisableCounting")
+	}
+}
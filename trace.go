@@ -0,0 +1,61 @@
+package crossover_activity
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+// W3C trace context headers
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// traceparentPattern a version 00 traceparent, capturing the trace id and the flags
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-[0-9a-f]{16}-([0-9a-f]{2})$`)
+
+// traceContextKey is the context key of the trace context of the request triggering a synchronous flush
+type traceContextKey struct{}
+
+// traceContext the W3C trace context headers of a request
+type traceContext struct {
+	traceparent string
+	tracestate  string
+}
+
+// withTraceContext returns a context carrying the trace context of the request so its synchronous flush joins its trace
+func withTraceContext(ctx context.Context, req *http.Request) context.Context {
+	traceparent := req.Header.Get(TraceparentHeader)
+	if len(traceparent) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, traceContextKey{}, traceContext{
+		traceparent: traceparent,
+		tracestate:  req.Header.Get(TracestateHeader),
+	})
+}
+
+// setTraceContext sets the trace context headers of the flush call, a child span of the trace carried
+// by the context if any, otherwise a new sampled trace since a batch spans many requests
+func setTraceContext(ctx context.Context, httpReq *http.Request) error {
+	spanId, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	if parent, ok := ctx.Value(traceContextKey{}).(traceContext); ok {
+		if match := traceparentPattern.FindStringSubmatch(parent.traceparent); match != nil {
+			httpReq.Header.Set(TraceparentHeader, "00-"+match[1]+"-"+spanId+"-"+match[2])
+			if len(parent.tracestate) != 0 {
+				httpReq.Header.Set(TracestateHeader, parent.tracestate)
+			}
+			return nil
+		}
+	}
+	traceId, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set(TraceparentHeader, "00-"+traceId+"-"+spanId+"-01")
+	return nil
+}
@@ -0,0 +1,52 @@
+package crossover_activity
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceFlushes(t *testing.T) {
+	remote := newRawRemote(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, TraceFlushes: true, SyncPattern: "^/critical"}, nil)
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		serve(a, "GET", "/node", "")
+		a.Flush()
+		_, header := remote.last()
+		traceparent := header.Get(TraceparentHeader)
+		match := traceparentPattern.FindStringSubmatch(traceparent)
+		if match == nil || match[2] != "01" {
+			t.Fatalf("traceparent = %q, want a well-formed sampled traceparent", traceparent)
+		}
+		if seen[match[1]] {
+			t.Fatalf("trace id %s reused by another flush", match[1])
+		}
+		seen[match[1]] = true
+	}
+
+	// a synchronous flush joins the trace of its request
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/critical", nil)
+	req.Header.Set(TraceparentHeader, parent)
+	req.Header.Set(TracestateHeader, "vendor=value")
+	a.ServeHTTP(httptest.NewRecorder(), req)
+	_, header := remote.last()
+	match := traceparentPattern.FindStringSubmatch(header.Get(TraceparentHeader))
+	if match == nil || match[1] != "4bf92f3577b34da6a3ce929d0e0e4736" || header.Get(TraceparentHeader) == parent {
+		t.Fatalf("traceparent = %q, want a child span of %q", header.Get(TraceparentHeader), parent)
+	}
+	if tracestate := header.Get(TracestateHeader); tracestate != "vendor=value" {
+		t.Fatalf("tracestate = %q, want the request's", tracestate)
+	}
+}
+
+func TestNoTraceFlushes(t *testing.T) {
+	remote := newRawRemote(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	serve(a, "GET", "/node", "")
+	a.Flush()
+	if _, header := remote.last(); len(header.Get(TraceparentHeader)) != 0 {
+		t.Fatalf("traceparent = %q, want none without TraceFlushes", header.Get(TraceparentHeader))
+	}
+}
@@ -0,0 +1,92 @@
+package crossover_activity
+
+import (
+	"sync"
+)
+
+// workerPool bounds the goroutines the plugin spawns for asynchronous work, the batchProcessor, the pipeline
+// stages and the overflow replay are long lived goroutines started once and aren't drawn from the pool.
+// a pool with a parent also takes a slot of the parent for each of its goroutines so the parent bounds both
+type workerPool struct {
+	slots  chan struct{}
+	parent *workerPool
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(size int, parent *workerPool) *workerPool {
+	return &workerPool{slots: make(chan struct{}, size), parent: parent}
+}
+
+// Go runs fn in a new goroutine once a slot is free, the caller blocks while the pool is full
+// so work beyond the bound is queued instead of growing the number of goroutines.
+// a nil pool runs fn in a new goroutine without bound
+func (p *workerPool) Go(fn func()) {
+	if p == nil {
+		go fn()
+		return
+	}
+	p.acquire()
+	p.start(fn)
+}
+
+// TryGo runs fn in a new goroutine if a slot is free right away and reports whether it did, so a goroutine
+// holding a slot can do the work itself instead of waiting for a slot that may never be released.
+// a nil pool runs fn in a new goroutine without bound
+func (p *workerPool) TryGo(fn func()) bool {
+	if p == nil {
+		go fn()
+		return true
+	}
+	if !p.tryAcquire() {
+		return false
+	}
+	p.start(fn)
+	return true
+}
+
+// start runs fn in a new goroutine holding the acquired slots
+func (p *workerPool) start(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.release()
+		fn()
+	}()
+}
+
+// acquire takes a slot of the pool and of its parents, waiting for them to be free
+func (p *workerPool) acquire() {
+	p.slots <- struct{}{}
+	if p.parent != nil {
+		p.parent.acquire()
+	}
+}
+
+// tryAcquire takes a slot of the pool and of its parents if they're free right away
+func (p *workerPool) tryAcquire() bool {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return false
+	}
+	if p.parent != nil && !p.parent.tryAcquire() {
+		<-p.slots
+		return false
+	}
+	return true
+}
+
+// release frees the slots taken by acquire
+func (p *workerPool) release() {
+	if p.parent != nil {
+		p.parent.release()
+	}
+	<-p.slots
+}
+
+// Wait waits for the running goroutines to return
+func (p *workerPool) Wait() {
+	if p != nil {
+		p.wg.Wait()
+	}
+}
@@ -0,0 +1,127 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolSharesParentBound(t *testing.T) {
+	parent := newWorkerPool(2, nil)
+	child := newWorkerPool(2, parent)
+
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	work := func() {
+		if n := running.Add(1); n > peak.Load() {
+			peak.Store(n)
+		}
+		<-release
+		running.Add(-1)
+	}
+	child.Go(work)
+	parent.Go(work)
+	if parent.TryGo(work) || child.TryGo(work) {
+		t.Fatal("TryGo started a goroutine beyond the parent bound")
+	}
+	close(release)
+	child.Wait()
+	parent.Wait()
+	if peak.Load() > 2 {
+		t.Fatalf("%d goroutines ran at once, want at most 2", peak.Load())
+	}
+	if !child.TryGo(func() {}) {
+		t.Fatal("TryGo didn't start a goroutine with free slots")
+	}
+	child.Wait()
+}
+
+func TestMaxWorkerGoroutinesBoundsGoroutines(t *testing.T) {
+	primary := newCollector(t)
+	var mirrored atomic.Int32
+	slowMirror := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		mirrored.Add(1)
+	}))
+	defer slowMirror.Close()
+	const workers = 3
+	a := newTestActivity(t, &Config{
+		RemoteAddress: primary.URL, RemoteAddresses: []string{slowMirror.URL}, FlushInterval: 60, BatchSize: 1,
+		MaxWorkerGoroutines: workers, FlushConcurrency: 2,
+	}, nil)
+
+	baseline := runtime.NumGoroutine()
+	var peak atomic.Int64
+	done := make(chan struct{})
+	var sampler sync.WaitGroup
+	sampler.Add(1)
+	go func() {
+		defer sampler.Done()
+		for {
+			if n := int64(runtime.NumGoroutine()); n > peak.Load() {
+				peak.Store(n)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				serve(a, "GET", "/node", "")
+			}
+		}()
+	}
+	wg.Wait()
+	waitFor(t, 10*time.Second, func() bool { return primary.count("node") == 100 && mirrored.Load() == 100 })
+	close(done)
+	sampler.Wait()
+
+	// the serving goroutines and the sampler, the workers and the goroutines of at most a connection per worker
+	// to each remote address on both ends
+	bound := int64(baseline + 4 + 1 + workers + 2*workers*3)
+	if peak.Load() > bound {
+		t.Errorf("%d goroutines at peak, want at most %d", peak.Load(), bound)
+	}
+}
+
+func TestFlushConcurrencyBoundsInFlightFlushes(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 3} {
+		var inFlight, peak, flushes atomic.Int32
+		var mu sync.Mutex
+		remote := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			mu.Lock()
+			if n := inFlight.Add(1); n > peak.Load() {
+				peak.Store(n)
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			inFlight.Add(-1)
+			flushes.Add(1)
+		}))
+		a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, BatchSize: 1, FlushConcurrency: concurrency}, nil)
+		for i := 0; i < 12; i++ {
+			serve(a, "GET", "/node", "")
+		}
+		waitFor(t, 5*time.Second, func() bool { return flushes.Load() == 12 })
+		remote.Close()
+
+		want := int32(concurrency)
+		if want == 0 {
+			want = 1
+		}
+		if peak.Load() != want {
+			t.Errorf("FlushConcurrency %d: %d flushes in flight at most, want %d", concurrency, peak.Load(), want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package crossover_activity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountOnlyProxied(t *testing.T) {
+	remote := newCollector(t)
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// the backend only serves /proxied, the other requests return without a response
+		if req.URL.Path == "/proxied" {
+			_, _ = rw.Write([]byte("ok"))
+		}
+	})
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, CountOnlyProxied: true}, next)
+
+	serve(a, "GET", "/proxied", "")
+	serve(a, "GET", "/proxied", "")
+	serve(a, "GET", "/skipped", "")
+
+	// an earlier middleware responding before handing the request over
+	outer := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusForbidden)
+		a.ServeHTTP(rw, req)
+	})
+	outer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/responded", nil))
+	a.Flush()
+
+	if proxied, skipped, responded := remote.count("proxied"), remote.count("skipped"), remote.count("responded"); proxied != 2 || skipped != 0 || responded != 0 {
+		t.Fatalf("counts = %d, %d, %d, want the proxied requests only", proxied, skipped, responded)
+	}
+}
+
+func TestCountsUnproxiedByDefault(t *testing.T) {
+	remote := newCollector(t)
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60}, nil)
+	serve(a, "GET", "/skipped", "")
+	a.Flush()
+	if count := remote.count("skipped"); count != 1 {
+		t.Fatalf("count = %d, want 1", count)
+	}
+}
+
+func TestRecordUpgrades(t *testing.T) {
+	remote := newCollector(t)
+	served := 0
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served++ })
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, RecordUpgrades: true}, next)
+
+	for _, header := range []http.Header{
+		{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"websocket"}},
+		{"Accept": {"text/event-stream"}},
+		{},
+	} {
+		req := httptest.NewRequest("GET", "/node", nil)
+		req.Header = header
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	a.Flush()
+
+	if served != 3 {
+		t.Fatalf("served = %d, want every request passed through", served)
+	}
+	types := map[string]int{}
+	for _, entry := range remote.entries() {
+		types[entry.Type] += entry.Count
+	}
+	if types[ConnectionWebSocket] != 1 || types[ConnectionSSE] != 1 || types[""] != 1 || len(types) != 3 {
+		t.Fatalf("types = %v, want one websocket, one sse and one regular request", types)
+	}
+}
+
+func TestCountOnlyStatus(t *testing.T) {
+	remote := newCollector(t)
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/failing":
+			rw.WriteHeader(http.StatusInternalServerError)
+		case "/silent":
+			// the server responds 200 once the handler returns
+		default:
+			_, _ = rw.Write([]byte("ok"))
+		}
+	})
+	a := newTestActivity(t, &Config{RemoteAddress: remote.URL, FlushInterval: 60, CountOnlyStatus: []int{http.StatusOK}}, next)
+	serve(a, "GET", "/ok", "")
+	serve(a, "GET", "/failing", "")
+	serve(a, "GET", "/silent", "")
+	a.Flush()
+	if ok, failing, silent := remote.count("ok"), remote.count("failing"), remote.count("silent"); ok != 1 || failing != 0 || silent != 1 {
+		t.Fatalf("counts = %d, %d, %d, want the 200 responses only", ok, failing, silent)
+	}
+}
+
+func TestStatusRecorderForwardsFlushAndHijack(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	var w http.ResponseWriter = &statusRecorder{ResponseWriter: recorder}
+	w.(http.Flusher).Flush()
+	if !recorder.Flushed {
+		t.Fatal("flush wasn't forwarded")
+	}
+	if status := w.(*statusRecorder).status; status != http.StatusOK {
+		t.Fatalf("status = %d after a flush, want 200", status)
+	}
+	// the recorder isn't a hijacker, the error is reported rather than panicking
+	if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+		t.Fatal("want an error hijacking a writer that can't be hijacked")
+	}
+
+	// the connection of a real server is hijacked through the recorder
+	hijacked := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, _, err := http.NewResponseController(&statusRecorder{ResponseWriter: rw}).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		hijacked <- err
+	}))
+	defer server.Close()
+	if resp, err := http.Get(server.URL); err == nil {
+		resp.Body.Close()
+	}
+	if err := <-hijacked; err != nil {
+		t.Fatalf("hijack through the recorder: %v", err)
+	}
+}